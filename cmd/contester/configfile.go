@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readConfigFile reads the config file at the given path, and provides its
+// entries as strings, in the same format as the corresponding flags.
+//
+// The format of the file is decided by its extension, which can be ".json",
+// ".yaml" or ".yml". Either way, the file holds a flat map from option names
+// to values. Lists, like partition kinds, can be given as lists.
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var entries map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		entries, err = parseJSONConfig(content)
+	case ".yaml", ".yml":
+		entries, err = parseYAMLConfig(string(content))
+	default:
+		return nil, fmt.Errorf("config file must be .json, .yaml or .yml: %s", path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return entries, nil
+}
+
+// parseJSONConfig parses a JSON object of options.
+func parseJSONConfig(content []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// Keep numbers as they are written, so that large seeds stay exact.
+	decoder.UseNumber()
+
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	entries := map[string]string{}
+	for name, value := range object {
+		switch value := value.(type) {
+		case string:
+			entries[name] = value
+		case json.Number, bool:
+			entries[name] = fmt.Sprint(value)
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			entries[name] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("unsupported value for %s: %v", name, value)
+		}
+	}
+
+	return entries, nil
+}
+
+// parseYAMLConfig parses the subset of YAML that is needed for a flat map of options.
+//
+// Supported are "name: value" entries with plain or quoted values, flow lists
+// like "[a, b]", block lists of "- item" lines, literal blocks introduced by
+// "|" (handy for nemesis schedules), and comments.
+func parseYAMLConfig(content string) (map[string]string, error) {
+	entries := map[string]string{}
+	lines := strings.Split(content, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := stripYAMLComment(lines[i])
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf(`line %d: expected "name: value"`, i+1)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		switch {
+		// A literal block holds all the following indented lines, as they are.
+		case value == "|":
+			var block []string
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || startsIndented(lines[i+1])) {
+				i++
+				block = append(block, strings.TrimSpace(lines[i]))
+			}
+			entries[name] = strings.TrimSpace(strings.Join(block, "\n"))
+
+		// A value on the following lines must be a block list.
+		case value == "":
+			var items []string
+			for i+1 < len(lines) {
+				next := strings.TrimSpace(stripYAMLComment(lines[i+1]))
+				if next != "" && !strings.HasPrefix(next, "-") {
+					break
+				}
+				i++
+				if next != "" {
+					items = append(items, unquoteYAML(strings.TrimSpace(strings.TrimPrefix(next, "-"))))
+				}
+			}
+			entries[name] = strings.Join(items, ",")
+
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			var items []string
+			for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, unquoteYAML(item))
+				}
+			}
+			entries[name] = strings.Join(items, ",")
+
+		default:
+			entries[name] = unquoteYAML(value)
+		}
+	}
+
+	return entries, nil
+}
+
+// stripYAMLComment removes the comment from the given line, if any. A comment
+// starts with a '#' at the start of the line or after a space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, char := range line {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t\r")
+}
+
+// startsIndented returns true if the given line starts with a space or a tab.
+func startsIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// unquoteYAML removes the quotes around a YAML value, if any.
+func unquoteYAML(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '"' || first == '\'') && first == last {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"contester/pkg/nemesis"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "plain values",
+			content: "algo: naive\nsessions: 50\n",
+			want:    map[string]string{"algo": "naive", "sessions": "50"},
+		},
+		{
+			name:    "document marker and comments",
+			content: "---\n# the algorithm\nalgo: naive # a broken one\n\n  # an indented comment\nsessions: 5\n",
+			want:    map[string]string{"algo": "naive", "sessions": "5"},
+		},
+		{
+			name:    "quoted values keep their '#' and spaces",
+			content: "algo: \"naive # not a comment\"\nreport-dir: ' reports '\nseed: 1#2\n",
+			want:    map[string]string{"algo": "naive # not a comment", "report-dir": " reports ", "seed": "1#2"},
+		},
+		{
+			name:    "flow list",
+			content: "partition-kinds: [halves, 'ring']\n",
+			want:    map[string]string{"partition-kinds": "halves,ring"},
+		},
+		{
+			name:    "block list",
+			content: "partition-kinds:\n  - halves\n  # skipped\n  - \"ring\"\nsessions: 2\n",
+			want:    map[string]string{"partition-kinds": "halves,ring", "sessions": "2"},
+		},
+		{
+			name: "literal block, like in the README",
+			content: "algo: kevlar\nsessions: 50\npartition-kinds: [halves, ring]\nnemesis: |\n" +
+				"  at 10µs partition {0,1}|{2,3,4}\n\n  at 2ms heal\n",
+			want: map[string]string{
+				"algo":            "kevlar",
+				"sessions":        "50",
+				"partition-kinds": "halves,ring",
+				"nemesis":         "at 10µs partition {0,1}|{2,3,4}\n\nat 2ms heal",
+			},
+		},
+		{
+			name:    "literal block ends at the next entry",
+			content: "nemesis: |\n  at 1ms heal # kept for the schedule parser\nalgo: naive\n",
+			want:    map[string]string{"nemesis": "at 1ms heal # kept for the schedule parser", "algo": "naive"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseYAMLConfig(test.content)
+			if err != nil {
+				t.Fatalf("parseYAMLConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseYAMLConfig() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "unexpected indentation", content: "algo: naive\n  sessions: 5\n", err: "line 2: unexpected indentation"},
+		{name: "missing colon", content: "algo naive\n", err: `line 1: expected "name: value"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseYAMLConfig(test.content)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseYAMLConfig() error = %v, want one with %q", err, test.err)
+			}
+		})
+	}
+}
+
+// writeConfigFile writes a config file with the given name and content into a temporary directory.
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseOptionsWithConfigFile(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.json"} {
+		t.Run(name, func(t *testing.T) {
+			content := "algo: naive\nsessions: 3\nnemesis: |\n  at 1ms crash 1\n  at 2ms restart 1\n"
+			if strings.HasSuffix(name, ".json") {
+				content = `{"algo": "naive", "sessions": 3, "nemesis": "at 1ms crash 1; at 2ms restart 1"}`
+			}
+			path := writeConfigFile(t, name, content)
+
+			// Flags take precedence over the file.
+			opts, err := parseOptions("run", []string{"-config", path, "-sessions", "7"})
+			if err != nil {
+				t.Fatalf("parseOptions() error = %v", err)
+			}
+			if opts.Algorithm != "naive" || opts.SessionCount != 7 {
+				t.Errorf("parseOptions() algorithm = %s, sessions = %d, want naive and 7", opts.Algorithm, opts.SessionCount)
+			}
+			schedule, ok := opts.Config.Nemesis.(nemesis.Schedule)
+			if !ok || len(schedule) != 2 || schedule[1].At != 2*time.Millisecond {
+				t.Errorf("parseOptions() nemesis = %v, want two events", opts.Config.Nemesis)
+			}
+		})
+	}
+}
+
+func TestParseOptionsRejectsUnknownEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{name: "unknown YAML entry", file: "config.yaml", content: "algo: naive\nalgorithm: raft\n", err: "unknown entry in config file: algorithm"},
+		{name: "unknown JSON entry", file: "config.json", content: `{"speed": 3}`, err: "unknown entry in config file: speed"},
+		{name: "nested config file", file: "config.yml", content: "config: other.yml\n", err: "unknown entry in config file: config"},
+		{name: "invalid value", file: "config.yaml", content: "sessions: many\n", err: "invalid value for sessions"},
+		{name: "unknown format", file: "config.toml", content: "", err: "config file must be .json, .yaml or .yml"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfigFile(t, test.file, test.content)
+			_, err := parseOptions("run", []string{"-config", path})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseOptions() error = %v, want one with %q", err, test.err)
+			}
+		})
+	}
+}
@@ -1,63 +1,133 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
+
+	// Algorithms register themselves with the simulation when imported.
+	_ "contester/pkg/kevlar"
+	_ "contester/pkg/naive"
+	_ "contester/pkg/paxos"
+	_ "contester/pkg/raft"
 
-	"contester/pkg/kevlar"
-	"contester/pkg/naive"
 	"contester/pkg/simulation"
 )
 
-const (
-	// Number of nodes in the system to be tested.
-	// Feel free to change it to any number > 1
-	nodeCount = 5
+const usage = `Usage: contester <command> [flags]
 
-	// Number of times the simulation should run.
-	runCount = 100
-)
+Commands:
+  run     runs simulation sessions against an algorithm, see "contester run -h"
+  shrink  reduces a failing session to a minimal counterexample, with the same
+          flags as run, and -seed of the failing session
+  scenario
+          runs the registered scenarios, or the named ones, and checks that
+          their outcome is the expected one
+  list    lists the registered algorithms
+`
 
 func main() {
-	for i := 0; i < runCount; i++ {
-		// Create new instances for every run.
-		instances := createKevlarInstances()
+	// The run command is the default one.
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-		// Run the simulation with newly created instances.
-		err := simulation.Run(simulation.QuickStartConfig, instances)
-		if err != nil {
-			panic(err)
-		}
+	switch command {
+	case "run":
+		os.Exit(runCommand(args))
+	case "shrink":
+		os.Exit(shrinkCommand(args))
+	case "scenario":
+		os.Exit(scenarioCommand(args))
+	case "list":
+		fmt.Println(strings.Join(simulation.Algorithms(), "\n"))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// runCommand runs the run command with the given arguments, and provides the exit code.
+func runCommand(args []string) int {
+	opts, code := parseCommandOptions("run", args)
+	if opts == nil {
+		return code
+	}
 
-		fmt.Printf("\rSession %d/%d passed.", i+1, runCount)
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "\n"+err.Error())
+		return 1
 	}
 
 	fmt.Println("\nConsensus maintained.")
+	return 0
 }
 
-func createNaiveInstances() []simulation.ExternalAPI {
-	internalAPIs := make([]*naive.Internal, nodeCount)
-	externalAPIs := make([]simulation.ExternalAPI, nodeCount)
-
-	for i := 0; i < nodeCount; i++ {
-		internalAPIs[i] = naive.NewInternal()
+// run all simulation sessions as per the given options.
+func run(opts *options) error {
+	createInstances, err := simulation.Lookup(opts.Algorithm)
+	if err != nil {
+		return err
 	}
-	for i := 0; i < nodeCount; i++ {
-		externalAPIs[i] = naive.NewExternal(internalAPIs)
+
+	conf := opts.Config
+	// The messages of all sessions so far.
+	var messages simulation.Messages
+	for i := 0; i < opts.SessionCount; i++ {
+		// Every session gets its own seed, unless the seeds are random.
+		if opts.Config.Seed != 0 {
+			conf.Seed = sessionSeed(opts.Config.Seed, i)
+		}
+
+		// Run the simulation with newly created instances.
+		report, err := simulation.RunWithReport(conf, createInstances(opts.NodeCount))
+		// Reports are written for failed sessions too, as long as they ran.
+		if report != nil {
+			if errWrite := writeReports(opts, fmt.Sprintf("session-%d", i+1), report); errWrite != nil {
+				return errWrite
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// The counts only grow, so the line never gets shorter than the one it overwrites.
+		messages = messages.Add(report.Messages)
+		fmt.Printf("\rSession %d/%d passed, %s so far.", i+1, opts.SessionCount, messages)
 	}
 
-	return externalAPIs
+	return nil
 }
 
-func createKevlarInstances() []simulation.ExternalAPI {
-	internalAPIs := make([]*kevlar.Internal, nodeCount)
-	externalAPIs := make([]simulation.ExternalAPI, nodeCount)
-
-	for i := 0; i < nodeCount; i++ {
-		internalAPIs[i] = kevlar.NewInternal()
+// parseCommandOptions parses the options of the given command. If they cannot be
+// parsed, it reports the problem and provides nil options, with the exit code.
+func parseCommandOptions(command string, args []string) (*options, int) {
+	opts, err := parseOptions(command, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, 0
+	}
+	if errors.Is(err, errReported) {
+		return nil, 2
 	}
-	for i := 0; i < nodeCount; i++ {
-		externalAPIs[i] = kevlar.NewExternal(internalAPIs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, 2
 	}
 
-	return externalAPIs
+	return opts, 0
+}
+
+// sessionSeed provides the seed of the given session, counting up from the given seed
+// of the first one. Zero is skipped, as it would make the seed of the session random.
+func sessionSeed(seed int64, session int) int64 {
+	next := seed + int64(session)
+	if seed < 0 && next >= 0 {
+		next++
+	}
+	return next
 }
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestSessionSeed(t *testing.T) {
+	tests := []struct {
+		seed    int64
+		session int
+		want    int64
+	}{
+		{seed: 5, session: 0, want: 5},
+		{seed: 5, session: 3, want: 8},
+		{seed: -2, session: 1, want: -1},
+		// Zero would pick a random seed.
+		{seed: -2, session: 2, want: 1},
+		{seed: -2, session: 3, want: 2},
+	}
+
+	for _, test := range tests {
+		if got := sessionSeed(test.seed, test.session); got != test.want {
+			t.Errorf("sessionSeed(%d, %d) = %d, want %d", test.seed, test.session, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"contester/pkg/nemesis"
+	"contester/pkg/simulation"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// errReported is returned for invalid flags, which the flag package reports by itself.
+var errReported = errors.New("invalid flags")
+
+// options of a contester invocation.
+type options struct {
+	// Algorithm is the name of the consensus algorithm to test.
+	Algorithm string
+	// NodeCount is the number of nodes in the system to be tested.
+	NodeCount int
+	// SessionCount is the number of times the simulation should run.
+	SessionCount int
+	// ConfigPath is the path of the config file, if any.
+	ConfigPath string
+	// ReportDir is the directory to write a JSON report of every session into, if any.
+	ReportDir string
+	// TimelineDir is the directory to write an HTML timeline of every session into, if any.
+	TimelineDir string
+	// Config for every simulation session.
+	Config simulation.Config
+}
+
+// parseOptions parses the options of the given command from the given command line arguments.
+//
+// Every option can be given as a flag, or as an entry of the config file, under
+// the same name as the flag. Flags take precedence over the config file, which
+// takes precedence over the defaults.
+func parseOptions(command string, args []string) (*options, error) {
+	opts := defaultOptions()
+
+	flags := newFlagSet(command, opts)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errReported
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	// Apply the config file, if any.
+	if opts.ConfigPath != "" {
+		// Remember the explicit flags, as the config file would override them.
+		explicit := map[string]string{}
+		flags.Visit(func(f *flag.Flag) { explicit[f.Name] = f.Value.String() })
+
+		entries, err := readConfigFile(opts.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range entries {
+			if name == "config" || flags.Lookup(name) == nil {
+				return nil, fmt.Errorf("unknown entry in config file: %s", name)
+			}
+			if err := flags.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid value for %s in config file: %w", name, err)
+			}
+		}
+
+		// Apply the explicit flags again.
+		for name, value := range explicit {
+			if err := flags.Set(name, value); err != nil {
+				return nil, fmt.Errorf("invalid value for flag -%s: %w", name, err)
+			}
+		}
+	}
+
+	if _, err := simulation.Lookup(opts.Algorithm); err != nil {
+		return nil, err
+	}
+	if opts.NodeCount < 1 {
+		return nil, fmt.Errorf("node count must be at least 1")
+	}
+	if opts.SessionCount < 1 {
+		return nil, fmt.Errorf("session count must be at least 1")
+	}
+
+	return opts, nil
+}
+
+// defaultOptions provides the options that apply when no flag or config file is given.
+func defaultOptions() *options {
+	return &options{
+		Algorithm:    "kevlar",
+		NodeCount:    5,
+		SessionCount: 100,
+		Config:       simulation.QuickStartConfig,
+	}
+}
+
+// newFlagSet creates the flags for all options of the given command. The flags write
+// directly into the given options, and their defaults are the current values of the options.
+func newFlagSet(command string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet("contester "+command, flag.ContinueOnError)
+	// Short hand for the simulation config.
+	conf := &opts.Config
+
+	flags.StringVar(&opts.Algorithm, "algo", opts.Algorithm, "registered consensus algorithm to test, see \"contester list\"")
+	flags.IntVar(&opts.NodeCount, "nodes", opts.NodeCount, "number of nodes in the system")
+	flags.IntVar(&opts.SessionCount, "sessions", opts.SessionCount, "number of simulation sessions to run")
+	flags.StringVar(&opts.ConfigPath, "config", opts.ConfigPath, "path of a JSON or YAML config file")
+	flags.StringVar(&opts.ReportDir, "report-dir", opts.ReportDir, "directory to write a JSON report of every session into")
+	flags.StringVar(&opts.TimelineDir, "timeline-dir", opts.TimelineDir, "directory to write an HTML timeline of every session into")
+
+	flags.Int64Var(&conf.Seed, "seed", conf.Seed,
+		"seed of the first session, every next session uses the next seed, skipping 0 (0 picks random seeds)")
+	flags.Int64Var(&conf.RequestCount, "request-count", conf.RequestCount,
+		"number of requests per session")
+	flags.DurationVar(&conf.RequestInterval, "request-interval", conf.RequestInterval,
+		"simulated delay between two consecutive requests")
+	flags.StringVar((*string)(&conf.Workload), "workload", string(conf.Workload),
+		"kind of requests to send, register or list-append (needs a list algorithm)")
+	flags.IntVar(&conf.KeyCount, "key-count", conf.KeyCount,
+		"number of keys that the requests are spread across (> 1 needs a keyed algorithm)")
+	flags.Float64Var(&conf.ReadRatio, "read-ratio", conf.ReadRatio,
+		"probability of a request being a Get instead of a Set")
+	flags.Float64Var(&conf.CASRatio, "cas-ratio", conf.CASRatio,
+		"probability of a write being a CompareAndSet instead of a Set (> 0 needs a CAS algorithm)")
+	flags.IntVar(&conf.MaxTransactionLength, "max-txn-length", conf.MaxTransactionLength,
+		"maximum number of micro-operations in a transaction of the list-append workload")
+
+	flags.Float64Var(&conf.NetworkFailureProbability, "network-failure-probability", conf.NetworkFailureProbability,
+		"failure probability of a network operation")
+	flags.DurationVar(&conf.NetworkMinDelay, "network-min-delay", conf.NetworkMinDelay,
+		"minimum delay of a network operation")
+	flags.DurationVar(&conf.NetworkMaxDelay, "network-max-delay", conf.NetworkMaxDelay,
+		"maximum delay of a network operation")
+	flags.Float64Var(&conf.NetworkDuplicateProbability, "network-duplicate-probability", conf.NetworkDuplicateProbability,
+		"probability of a delivered request being delivered once more, later")
+	flags.Float64Var(&conf.NetworkReorderProbability, "network-reorder-probability", conf.NetworkReorderProbability,
+		"probability of a message being held back for reordering")
+	flags.DurationVar(&conf.NetworkReorderWindow, "network-reorder-window", conf.NetworkReorderWindow,
+		"maximum extra delay of a held back message")
+
+	flags.DurationVar(&conf.MaxClockOffset, "max-clock-offset", conf.MaxClockOffset,
+		"maximum offset of a node's clock")
+	flags.Float64Var(&conf.MaxClockDrift, "max-clock-drift", conf.MaxClockDrift,
+		"maximum rate at which a node's clock gains or loses time")
+	flags.DurationVar(&conf.MaxClockJump, "max-clock-jump", conf.MaxClockJump,
+		"maximum step of a node's clock (0 disables clock jumps)")
+	flags.DurationVar(&conf.ClockJumpInterval, "clock-jump-interval", conf.ClockJumpInterval,
+		"simulated time between two clock jumps")
+
+	flags.Var((*partitionKindsValue)(&conf.PartitionKinds), "partition-kinds",
+		"comma separated kinds of random partitions (empty disables partitions)")
+	flags.DurationVar(&conf.PartitionInterval, "partition-interval", conf.PartitionInterval,
+		"simulated time for which the network stays healthy before a partition")
+	flags.DurationVar(&conf.PartitionDuration, "partition-duration", conf.PartitionDuration,
+		"simulated time for which a partition lasts")
+
+	flags.DurationVar(&conf.CrashInterval, "crash-interval", conf.CrashInterval,
+		"simulated time for which all nodes stay up before a crash")
+	flags.DurationVar(&conf.CrashDuration, "crash-duration", conf.CrashDuration,
+		"simulated time for which a crashed node stays down (0 disables crashes)")
+	flags.BoolVar(&conf.CrashAmnesia, "crash-amnesia", conf.CrashAmnesia,
+		"make crashed nodes lose their in-memory state")
+
+	flags.Var(&nemesisValue{target: &conf.Nemesis}, "nemesis",
+		`fault schedule, like "at 10ms partition {0,1}|{2,3,4}, at 50ms heal"`)
+
+	return flags
+}
+
+// partitionKindsValue is a flag.Value for a comma separated list of partition kinds.
+type partitionKindsValue []simulation.PartitionKind
+
+func (p *partitionKindsValue) String() string {
+	kinds := make([]string, len(*p))
+	for i, kind := range *p {
+		kinds[i] = string(kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+func (p *partitionKindsValue) Set(value string) error {
+	// The list is replaced, not extended.
+	*p = nil
+	for _, kind := range strings.Split(value, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			*p = append(*p, simulation.PartitionKind(kind))
+		}
+	}
+	return nil
+}
+
+// nemesisValue is a flag.Value for a nemesis schedule.
+type nemesisValue struct {
+	target *simulation.Nemesis
+}
+
+func (n *nemesisValue) String() string {
+	// The flag package calls String on a zero value to detect defaults.
+	if n == nil || n.target == nil || *n.target == nil {
+		return ""
+	}
+	return fmt.Sprint(*n.target)
+}
+
+func (n *nemesisValue) Set(value string) error {
+	schedule, err := nemesis.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	// An empty schedule means no nemesis at all.
+	*n.target = nil
+	if len(schedule) > 0 {
+		*n.target = schedule
+	}
+	return nil
+}
+
+// commandLine provides the flags that reproduce the given options, leaving out
+// the flags that have their default value.
+func commandLine(opts *options) []string {
+	defaults := newFlagSet("", defaultOptions())
+
+	var args []string
+	newFlagSet("", opts).VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if value != defaults.Lookup(f.Name).Value.String() {
+			args = append(args, fmt.Sprintf("-%s=%s", f.Name, shellQuote(value)))
+		}
+	})
+	return args
+}
+
+// shellQuote quotes the given value for a shell, if it needs quotes at all.
+func shellQuote(value string) string {
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.,-_µ") == "" {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"contester/pkg/simulation"
+	"contester/pkg/timeline"
+)
+
+// sessionReport is the report of a session, as written into the report directory.
+type sessionReport struct {
+	// Algorithm that was tested.
+	Algorithm string
+	*simulation.Report
+}
+
+// writeReports writes the report of a session under the given name, like
+// "session-1", as JSON into the report directory and as an HTML timeline into
+// the timeline directory. Either directory is skipped if it is not set.
+func writeReports(opts *options, name string, report *simulation.Report) error {
+	if opts.ReportDir != "" {
+		content, err := json.MarshalIndent(sessionReport{Algorithm: opts.Algorithm, Report: report}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+
+		if err := writeFile(opts.ReportDir, name+".json", append(content, '\n')); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	if opts.TimelineDir != "" {
+		var content bytes.Buffer
+		if err := timeline.Render(&content, report); err != nil {
+			return fmt.Errorf("failed to render timeline: %w", err)
+		}
+
+		if err := writeFile(opts.TimelineDir, name+".html", content.Bytes()); err != nil {
+			return fmt.Errorf("failed to write timeline: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the given content into the file with the given name in the
+// given directory, which is created if needed.
+func writeFile(dir, name string, content []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), content, 0o644)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"contester/pkg/scenario"
+)
+
+// scenarioCommand runs the scenario command with the given arguments, and provides
+// the exit code. The arguments name the scenarios to run, all of them if there is none.
+func scenarioCommand(args []string) int {
+	names := args
+	if len(names) == 0 {
+		names = scenario.Names()
+	}
+
+	// Look all scenarios up first, so that a typo does not wait for the others to run.
+	scenarios := make([]scenario.Scenario, len(names))
+	for i, name := range names {
+		s, err := scenario.Lookup(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		scenarios[i] = s
+	}
+
+	failed := 0
+	for _, s := range scenarios {
+		result, err := scenario.Run(s)
+		if err != nil {
+			fmt.Printf("FAILED  %s: %v\n", s.Name, err)
+			failed++
+			continue
+		}
+
+		if !result.Ok {
+			failed++
+			fmt.Printf("FAILED  %s\n", s.Name)
+			fmt.Printf("        %s\n", s.Description)
+			if s.ExpectFailure {
+				fmt.Printf("        no failure in %d sessions\n", result.Sessions)
+			} else {
+				fmt.Printf("        %v\n", result.Failure)
+			}
+			continue
+		}
+
+		fmt.Printf("ok      %s\n", s.Name)
+		fmt.Printf("        %s\n", s.Description)
+		// The demonstration of the problem is worth showing.
+		if result.Failure != nil {
+			fmt.Printf("        %v\n", result.Failure)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d scenarios failed.\n", failed, len(scenarios))
+		return 1
+	}
+	fmt.Printf("\nAll %d scenarios passed.\n", len(scenarios))
+	return 0
+}
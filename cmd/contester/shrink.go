@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"contester/pkg/shrink"
+	"contester/pkg/simulation"
+)
+
+// shrinkCommand runs the shrink command with the given arguments, and provides the exit code.
+func shrinkCommand(args []string) int {
+	opts, code := parseCommandOptions("shrink", args)
+	if opts == nil {
+		return code
+	}
+
+	if opts.Config.Seed == 0 {
+		fmt.Fprintln(os.Stderr, "the seed of the failing session must be given with -seed")
+		return 2
+	}
+
+	// The algorithm is known to exist, as the options are validated.
+	factory, _ := simulation.Lookup(opts.Algorithm)
+
+	result, err := shrink.Shrink(factory, opts.Config, opts.NodeCount)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// The options that reproduce the smallest failing session.
+	smallest := &options{
+		Algorithm:    opts.Algorithm,
+		NodeCount:    result.NodeCount,
+		SessionCount: 1,
+		Config:       result.Config,
+	}
+
+	fmt.Printf("Shrunk the failing session in %d runs, down to %d nodes and %d requests.\n\n",
+		result.Runs, result.NodeCount, result.Config.RequestCount)
+	fmt.Printf("Replay it with:\n  contester run %s\n\n", strings.Join(commandLine(smallest), " "))
+	if result.ReplayFailed {
+		fmt.Printf("Faults:\n  random, as replaying the recorded faults did not reproduce the failure\n\n")
+	} else {
+		fmt.Printf("Faults:\n%s\n\n", indent(strings.ReplaceAll(result.Schedule.String(), "; ", "\n")))
+	}
+	fmt.Printf("History:\n%s\n\n", indent(result.History.String()))
+	fmt.Printf("Messages:\n%s\n\n", indent(result.Report.Messages.String()))
+	fmt.Printf("Failure:\n%s\n", indent(result.Err.Error()))
+
+	// The smallest failing session is reported like any other session.
+	if err := writeReports(opts, "shrunk", result.Report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	return 1
+}
+
+// indent indents every line of the given text. An empty text becomes "  (none)".
+func indent(text string) string {
+	if text == "" {
+		return "  (none)"
+	}
+	return "  " + strings.ReplaceAll(text, "\n", "\n  ")
+}
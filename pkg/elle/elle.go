@@ -0,0 +1,447 @@
+// Package elle checks histories of list-append transactions for isolation
+// anomalies, the way Jepsen's Elle does.
+//
+// Every transaction is a sequence of micro-operations that either append a
+// unique value to the list of a key, or read the whole list of a key. As the
+// values are unique, the lists tell exactly which transaction wrote what, and in
+// which order. That allows the checker to infer the dependencies between the
+// transactions, and to explain a broken history with the anomaly it shows,
+// instead of a plain "not linearizable":
+//
+//   - G0, write cycles: transactions overwrite each other in a cycle.
+//   - G1a, aborted reads: a value of a failed transaction is read.
+//   - G1b, intermediate reads: a value is read that its transaction appended
+//     to before it finished.
+//   - G1c, cyclic information flow: transactions write and read from each
+//     other in a cycle.
+//   - G-single, read skew: a cycle with exactly one anti-dependency, that is,
+//     one transaction that misses the write of another.
+//   - G2, write skew and friends: a cycle with many anti-dependencies.
+//   - Lost updates: transactions read the same version of a key and append to it.
+//
+// The cycles are searched with the real-time order of the transactions too,
+// as linearizable systems must respect it. A cycle that needs it is reported
+// with a "-realtime" suffix, like G-single-realtime for a stale read.
+package elle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MicroOpKind is the kind of a micro-operation.
+type MicroOpKind string
+
+const (
+	// Append appends a value to the list of a key.
+	Append MicroOpKind = "append"
+	// Read reads the list of a key.
+	Read MicroOpKind = "r"
+)
+
+// MicroOp is a single step of a transaction.
+type MicroOp struct {
+	Kind MicroOpKind
+	// Key of the list.
+	Key string
+	// Value to append. Values must be unique per key.
+	Value int
+	// List is the result of a read. It is nil for appends and unknown reads.
+	List []int
+}
+
+// Status is the outcome of a transaction.
+type Status string
+
+const (
+	// StatusOk means that the transaction committed.
+	StatusOk Status = "ok"
+	// StatusFailed means that the transaction certainly did not take effect.
+	StatusFailed Status = "fail"
+	// StatusUnknown means that the transaction may or may not have taken effect,
+	// like one that timed out.
+	StatusUnknown Status = "info"
+)
+
+// Transaction is a single transaction in a history.
+type Transaction struct {
+	// ID of the transaction, which the anomalies refer to.
+	ID int
+	// Ops of the transaction, in order. Reads of transactions that did not
+	// commit have no results.
+	Ops    []MicroOp
+	Status Status
+
+	// Call and Return are positions of the invocation and the completion of the
+	// transaction on a common timeline, like in the linearizability package.
+	// Return is ignored for transactions that did not commit.
+	Call, Return int64
+}
+
+// EdgeKind is the kind of a dependency between two transactions.
+type EdgeKind string
+
+const (
+	// WW is a write dependency: the second transaction appended after the first one.
+	WW EdgeKind = "ww"
+	// WR is a read dependency: the second transaction read the append of the first one.
+	WR EdgeKind = "wr"
+	// RW is an anti-dependency: the first transaction read a list that misses
+	// the append of the second one.
+	RW EdgeKind = "rw"
+	// Realtime is a real-time dependency: the first transaction completed
+	// before the second one was invoked.
+	Realtime EdgeKind = "realtime"
+)
+
+// Edge is a dependency from one transaction to another.
+type Edge struct {
+	// From and To are the IDs of the transactions.
+	From, To int
+	Kind     EdgeKind
+	// Key that the dependency comes from. It is empty for real-time dependencies.
+	Key string
+}
+
+// String formats the edge like `T1 -ww key-0-> T2`.
+func (e Edge) String() string {
+	if e.Kind == Realtime {
+		return fmt.Sprintf("T%d -realtime-> T%d", e.From, e.To)
+	}
+	return fmt.Sprintf("T%d -%s %s-> T%d", e.From, e.Kind, e.Key, e.To)
+}
+
+// AnomalyKind is the kind of an anomaly.
+type AnomalyKind string
+
+const (
+	G0      AnomalyKind = "G0"
+	G1a     AnomalyKind = "G1a"
+	G1b     AnomalyKind = "G1b"
+	G1c     AnomalyKind = "G1c"
+	GSingle AnomalyKind = "G-single"
+	G2      AnomalyKind = "G2"
+	// LostUpdate means that transactions read the same version of a key and
+	// appended to it, so that one of the appends should have been lost.
+	LostUpdate AnomalyKind = "lost-update"
+	// IncompatibleOrder means that two reads of a key disagree on the order of
+	// its values, so that neither is a prefix of the other.
+	IncompatibleOrder AnomalyKind = "incompatible-order"
+	// DuplicateElements means that a read holds the same value twice.
+	DuplicateElements AnomalyKind = "duplicate-elements"
+	// Internal means that a transaction did not observe its own appends, or
+	// read a key differently within itself.
+	Internal AnomalyKind = "internal"
+)
+
+// Anomaly found in a history.
+type Anomaly struct {
+	Kind AnomalyKind
+	// Transactions holds the IDs of the transactions that take part.
+	Transactions []int
+	// Cycle holds the dependencies that form the cycle, for cycle anomalies.
+	Cycle []Edge
+	// Description is a human readable explanation of the anomaly.
+	Description string
+}
+
+// Result of a check.
+type Result struct {
+	// Ok is true if no anomaly was found.
+	Ok bool
+	// Anomalies in the order of their kinds, as they are checked.
+	Anomalies []Anomaly
+}
+
+// Kinds provides the distinct kinds of the anomalies in the result, in order.
+func (r Result) Kinds() []AnomalyKind {
+	var kinds []AnomalyKind
+	seen := map[AnomalyKind]bool{}
+	for _, anomaly := range r.Anomalies {
+		if !seen[anomaly.Kind] {
+			seen[anomaly.Kind] = true
+			kinds = append(kinds, anomaly.Kind)
+		}
+	}
+	return kinds
+}
+
+// Check searches the given history for anomalies.
+func Check(history []Transaction) Result {
+	c := newChecker(history)
+
+	c.checkInternal()
+	c.inferOrders()
+	c.checkDirtyReads()
+	c.checkLostUpdates()
+	c.checkCycles()
+
+	return Result{Ok: len(c.anomalies) == 0, Anomalies: c.anomalies}
+}
+
+// writeRef identifies an append within a history.
+type writeRef struct {
+	// txn is the index of the transaction in the history.
+	txn int
+	// op is the index of the micro-operation in the transaction.
+	op int
+}
+
+// checker holds the state of a check.
+type checker struct {
+	history []Transaction
+	// keys holds all keys of the history, sorted, for deterministic results.
+	keys []string
+	// writes maps every appended value of every key to its append.
+	writes map[string]map[int]writeRef
+	// orders holds the inferred order of the values of every key.
+	orders map[string][]int
+
+	anomalies []Anomaly
+}
+
+// newChecker creates a checker for the given history.
+func newChecker(history []Transaction) *checker {
+	c := &checker{
+		history: history,
+		writes:  map[string]map[int]writeRef{},
+		orders:  map[string][]int{},
+	}
+
+	for t, txn := range history {
+		for o, op := range txn.Ops {
+			if c.writes[op.Key] == nil {
+				c.writes[op.Key] = map[int]writeRef{}
+				c.keys = append(c.keys, op.Key)
+			}
+			if op.Kind == Append {
+				c.writes[op.Key][op.Value] = writeRef{txn: t, op: o}
+			}
+		}
+	}
+	sort.Strings(c.keys)
+
+	return c
+}
+
+// report records an anomaly.
+func (c *checker) report(kind AnomalyKind, txns []int, format string, args ...any) {
+	ids := make([]int, len(txns))
+	for i, t := range txns {
+		ids[i] = c.history[t].ID
+	}
+	c.anomalies = append(c.anomalies, Anomaly{Kind: kind, Transactions: ids, Description: fmt.Sprintf(format, args...)})
+}
+
+// reads calls the given function for every read of a committed transaction.
+func (c *checker) reads(fn func(t, o int, op MicroOp)) {
+	for t, txn := range c.history {
+		if txn.Status != StatusOk {
+			continue
+		}
+		for o, op := range txn.Ops {
+			if op.Kind == Read {
+				fn(t, o, op)
+			}
+		}
+	}
+}
+
+// checkInternal makes sure that every committed transaction is consistent with
+// itself, and that no read holds duplicates.
+func (c *checker) checkInternal() {
+	for t, txn := range c.history {
+		if txn.Status != StatusOk {
+			continue
+		}
+
+		// What the transaction knows about every key: the list it last read,
+		// if any, and what it appended since.
+		type view struct {
+			read     []int
+			known    bool
+			appended []int
+		}
+		views := map[string]*view{}
+
+		for _, op := range txn.Ops {
+			v := views[op.Key]
+			if v == nil {
+				v = &view{}
+				views[op.Key] = v
+			}
+
+			if op.Kind == Append {
+				v.appended = append(v.appended, op.Value)
+				continue
+			}
+
+			if duplicate, found := findDuplicate(op.List); found {
+				c.report(DuplicateElements, []int{t}, "T%d read %d twice in %s %v", txn.ID, duplicate, op.Key, op.List)
+			}
+
+			// The read must show the earlier read and the appends since. Without an
+			// earlier read, it must at least end with the appends.
+			expected := v.appended
+			consistent := hasSuffix(op.List, v.appended)
+			if v.known {
+				expected = append(append([]int{}, v.read...), v.appended...)
+				consistent = equalLists(op.List, expected)
+			}
+			if !consistent {
+				c.report(Internal, []int{t}, "T%d read %s %v, but its own earlier operations imply %v", txn.ID, op.Key, op.List, expected)
+			}
+
+			v.read, v.known, v.appended = op.List, true, nil
+		}
+	}
+}
+
+// inferOrders infers the order of the values of every key from the longest read
+// of it. All other reads must be prefixes of it.
+func (c *checker) inferOrders() {
+	// The longest read of every key, and the transaction that made it.
+	longest := map[string]int{}
+	c.reads(func(t, _ int, op MicroOp) {
+		if _, found := longest[op.Key]; !found || len(op.List) > len(c.orders[op.Key]) {
+			c.orders[op.Key] = op.List
+			longest[op.Key] = t
+		}
+	})
+
+	reported := map[string]bool{}
+	c.reads(func(t, _ int, op MicroOp) {
+		order := c.orders[op.Key]
+		if reported[op.Key] || isPrefix(op.List, order) {
+			return
+		}
+
+		// One report per key is enough to explain the problem.
+		reported[op.Key] = true
+		other := longest[op.Key]
+		c.report(IncompatibleOrder, []int{t, other}, "T%d read %s %v, which disagrees with %v read by T%d",
+			c.history[t].ID, op.Key, op.List, order, c.history[other].ID)
+	})
+}
+
+// checkDirtyReads searches for reads of values of failed transactions, and for
+// reads of intermediate states of other transactions.
+func (c *checker) checkDirtyReads() {
+	c.reads(func(t, _ int, op MicroOp) {
+		id := c.history[t].ID
+
+		for _, value := range op.List {
+			write, exists := c.writes[op.Key][value]
+			if exists && c.history[write.txn].Status == StatusFailed {
+				c.report(G1a, []int{t, write.txn}, "T%d read %d of %s, which was appended by the failed T%d",
+					id, value, op.Key, c.history[write.txn].ID)
+			}
+		}
+
+		if len(op.List) == 0 {
+			return
+		}
+
+		// The last value of the read must be the last append of its transaction to the key.
+		last := op.List[len(op.List)-1]
+		write, exists := c.writes[op.Key][last]
+		if !exists || write.txn == t {
+			return
+		}
+		for _, later := range c.history[write.txn].Ops[write.op+1:] {
+			if later.Kind == Append && later.Key == op.Key {
+				c.report(G1b, []int{t, write.txn}, "T%d read %s %v, an intermediate state of T%d, which appended %d next",
+					id, op.Key, op.List, c.history[write.txn].ID, later.Value)
+				return
+			}
+		}
+	})
+}
+
+// checkLostUpdates searches for committed transactions that read the same
+// version of a key before appending to it.
+func (c *checker) checkLostUpdates() {
+	type version struct {
+		key    string
+		length int
+	}
+	// The transactions that read every version, and appended to it afterwards.
+	updates := map[version][]int{}
+	var versions []version
+
+	for t, txn := range c.history {
+		if txn.Status != StatusOk {
+			continue
+		}
+
+		// The version of every key that the transaction read first, if it did
+		// so before appending to it.
+		read := map[string]int{}
+		seen := map[string]bool{}
+		for _, op := range txn.Ops {
+			if seen[op.Key] {
+				if _, found := read[op.Key]; found && op.Kind == Append {
+					v := version{key: op.Key, length: read[op.Key]}
+					if len(updates[v]) == 0 {
+						versions = append(versions, v)
+					}
+					updates[v] = append(updates[v], t)
+					// Count the transaction once per key.
+					delete(read, op.Key)
+				}
+				continue
+			}
+
+			seen[op.Key] = true
+			if op.Kind == Read {
+				read[op.Key] = len(op.List)
+			}
+		}
+	}
+
+	for _, v := range versions {
+		if txns := updates[v]; len(txns) > 1 {
+			ids := make([]string, len(txns))
+			for i, t := range txns {
+				ids[i] = fmt.Sprintf("T%d", c.history[t].ID)
+			}
+			c.report(LostUpdate, txns, "%s all read %s with %d values, and appended to it",
+				strings.Join(ids, ", "), v.key, v.length)
+		}
+	}
+}
+
+// findDuplicate provides a value that appears twice in the given list.
+func findDuplicate(list []int) (int, bool) {
+	seen := map[int]bool{}
+	for _, value := range list {
+		if seen[value] {
+			return value, true
+		}
+		seen[value] = true
+	}
+	return 0, false
+}
+
+// isPrefix returns true if the first list is a prefix of the second one.
+func isPrefix(prefix, list []int) bool {
+	return len(prefix) <= len(list) && equalLists(prefix, list[:len(prefix)])
+}
+
+// hasSuffix returns true if the list ends with the given suffix.
+func hasSuffix(list, suffix []int) bool {
+	return len(suffix) <= len(list) && equalLists(list[len(list)-len(suffix):], suffix)
+}
+
+func equalLists(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
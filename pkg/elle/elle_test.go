@@ -0,0 +1,193 @@
+package elle
+
+import (
+	"reflect"
+	"testing"
+)
+
+// appendOp appends the given value to the list of the given key.
+func appendOp(key string, value int) MicroOp {
+	return MicroOp{Kind: Append, Key: key, Value: value}
+}
+
+// readOp reads the given list of the given key.
+func readOp(key string, list ...int) MicroOp {
+	if list == nil {
+		list = []int{}
+	}
+	return MicroOp{Kind: Read, Key: key, List: list}
+}
+
+// ok is a committed transaction with the given operations.
+func ok(ops ...MicroOp) Transaction {
+	return Transaction{Status: StatusOk, Ops: ops}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		txns []Transaction
+		// sequential makes every transaction complete before the next one is
+		// invoked. Otherwise, they are all concurrent.
+		sequential bool
+		want       []AnomalyKind
+	}{
+		{
+			name: "clean history",
+			txns: []Transaction{
+				ok(appendOp("x", 1)),
+				ok(readOp("x", 1), appendOp("x", 2), appendOp("y", 1)),
+				ok(readOp("x", 1, 2), readOp("y", 1)),
+			},
+			sequential: true,
+		},
+		{
+			name: "G0, write cycle",
+			txns: []Transaction{
+				ok(appendOp("x", 1), appendOp("y", 2)),
+				ok(appendOp("x", 2), appendOp("y", 1)),
+				ok(readOp("x", 1, 2), readOp("y", 1, 2)),
+			},
+			want: []AnomalyKind{G0},
+		},
+		{
+			name: "G1a, aborted read",
+			txns: []Transaction{
+				{Status: StatusFailed, Ops: []MicroOp{appendOp("x", 1)}},
+				ok(readOp("x", 1)),
+			},
+			want: []AnomalyKind{G1a},
+		},
+		{
+			name: "G1b, intermediate read",
+			txns: []Transaction{
+				ok(appendOp("x", 1), appendOp("x", 2)),
+				ok(readOp("x", 1)),
+			},
+			want: []AnomalyKind{G1b},
+		},
+		{
+			name: "G1c, cyclic information flow",
+			txns: []Transaction{
+				ok(appendOp("x", 1), readOp("y", 1)),
+				ok(appendOp("y", 1), readOp("x", 1)),
+			},
+			want: []AnomalyKind{G1c},
+		},
+		{
+			name: "G-single, read skew",
+			txns: []Transaction{
+				ok(appendOp("x", 1), appendOp("y", 1)),
+				ok(readOp("x"), readOp("y", 1)),
+				ok(readOp("x", 1)),
+			},
+			want: []AnomalyKind{GSingle},
+		},
+		{
+			name: "G2, write skew",
+			txns: []Transaction{
+				ok(readOp("x"), appendOp("y", 1)),
+				ok(readOp("y"), appendOp("x", 1)),
+				ok(readOp("x", 1), readOp("y", 1)),
+			},
+			want: []AnomalyKind{G2},
+		},
+		{
+			name: "G-single-realtime, stale read",
+			txns: []Transaction{
+				ok(appendOp("x", 1)),
+				ok(readOp("x")),
+				ok(readOp("x", 1)),
+			},
+			sequential: true,
+			want:       []AnomalyKind{GSingle + "-realtime"},
+		},
+		{
+			// Both appends to the same version make a read skew as well.
+			name: "lost update",
+			txns: []Transaction{
+				ok(readOp("x"), appendOp("x", 1)),
+				ok(readOp("x"), appendOp("x", 2)),
+				ok(readOp("x", 1, 2)),
+			},
+			want: []AnomalyKind{LostUpdate, GSingle},
+		},
+		{
+			name: "internal, own append not observed",
+			txns: []Transaction{
+				ok(appendOp("x", 1), readOp("x")),
+			},
+			want: []AnomalyKind{Internal},
+		},
+		{
+			name: "incompatible order",
+			txns: []Transaction{
+				ok(appendOp("x", 1)),
+				ok(appendOp("x", 2)),
+				ok(readOp("x", 1, 2)),
+				ok(readOp("x", 2, 1)),
+			},
+			want: []AnomalyKind{IncompatibleOrder},
+		},
+		{
+			name: "duplicate elements",
+			txns: []Transaction{
+				ok(appendOp("x", 1)),
+				ok(readOp("x", 1, 1)),
+			},
+			want: []AnomalyKind{DuplicateElements},
+		},
+		{
+			// A transaction of unknown outcome may have committed, so reading
+			// its value is fine.
+			name: "read of a transaction of unknown outcome",
+			txns: []Transaction{
+				{Status: StatusUnknown, Ops: []MicroOp{appendOp("x", 1)}},
+				ok(readOp("x", 1)),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := range test.txns {
+				test.txns[i].ID = i
+				test.txns[i].Call, test.txns[i].Return = 0, int64(len(test.txns))
+				if test.sequential {
+					test.txns[i].Call, test.txns[i].Return = int64(2*i), int64(2*i+1)
+				}
+			}
+
+			result := Check(test.txns)
+			if kinds := result.Kinds(); !reflect.DeepEqual(kinds, test.want) {
+				t.Fatalf("Check() kinds = %v, want %v, anomalies: %+v", kinds, test.want, result.Anomalies)
+			}
+			if result.Ok != (len(test.want) == 0) {
+				t.Errorf("Check() ok = %t with anomalies %v", result.Ok, result.Kinds())
+			}
+			for _, anomaly := range result.Anomalies {
+				if anomaly.Description == "" || len(anomaly.Transactions) == 0 {
+					t.Errorf("Check() anomaly %+v lacks a description or transactions", anomaly)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReportsCycle(t *testing.T) {
+	// The IDs differ from the indexes in the history, as the anomalies must use the IDs.
+	txns := []Transaction{
+		{ID: 10, Status: StatusOk, Ops: []MicroOp{appendOp("x", 1), readOp("y", 1)}},
+		{ID: 20, Status: StatusOk, Ops: []MicroOp{appendOp("y", 1), readOp("x", 1)}},
+	}
+
+	result := Check(txns)
+	if len(result.Anomalies) != 1 {
+		t.Fatalf("Check() anomalies = %+v, want a single G1c", result.Anomalies)
+	}
+
+	want := []Edge{{From: 20, To: 10, Kind: WR, Key: "y"}, {From: 10, To: 20, Kind: WR, Key: "x"}}
+	if cycle := result.Anomalies[0].Cycle; !reflect.DeepEqual(cycle, want) {
+		t.Errorf("Check() cycle = %v, want %v", cycle, want)
+	}
+}
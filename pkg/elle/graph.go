@@ -0,0 +1,354 @@
+package elle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// graph of the dependencies between transactions. Its nodes are indexes of
+// transactions in the history.
+type graph struct {
+	// edges holds the outgoing edges of every node. Edges refer to history
+	// indexes too, until they are reported.
+	edges map[int][]Edge
+	// nodes in the order of the history.
+	nodes []int
+}
+
+// cycleSpec describes a kind of cycle to search for.
+type cycleSpec struct {
+	kind AnomalyKind
+	// first is the kind of the edge that every such cycle has.
+	first EdgeKind
+	// rest holds the kinds of the edges that may make up the rest of the cycle.
+	rest []EdgeKind
+	// required is a kind of edge that the rest of the cycle must have, if any.
+	required EdgeKind
+}
+
+// cycleSpecs in the order of the search. A cycle is reported as the first kind
+// that it matches, and only the cycles that need real-time dependencies are
+// reported with a realtime kind.
+var cycleSpecs = []cycleSpec{
+	{kind: G0, first: WW, rest: []EdgeKind{WW}},
+	{kind: G1c, first: WR, rest: []EdgeKind{WW, WR}},
+	{kind: GSingle, first: RW, rest: []EdgeKind{WW, WR}},
+	{kind: G2, first: RW, rest: []EdgeKind{WW, WR, RW}, required: RW},
+	{kind: G0 + "-realtime", first: WW, rest: []EdgeKind{WW, Realtime}, required: Realtime},
+	{kind: G1c + "-realtime", first: WR, rest: []EdgeKind{WW, WR, Realtime}, required: Realtime},
+	{kind: GSingle + "-realtime", first: RW, rest: []EdgeKind{WW, WR, Realtime}, required: Realtime},
+	{kind: G2 + "-realtime", first: RW, rest: []EdgeKind{WW, WR, RW, Realtime}, required: Realtime},
+}
+
+// checkCycles builds the dependency graph, and reports the cycles in it.
+func (c *checker) checkCycles() {
+	g := c.buildGraph()
+
+	for _, component := range g.components() {
+		// Every kind of cycle is reported once per component, unless a more
+		// basic kind covers it already.
+		found := map[AnomalyKind]bool{}
+		for _, spec := range cycleSpecs {
+			base := AnomalyKind(strings.TrimSuffix(string(spec.kind), "-realtime"))
+			if found[base] {
+				continue
+			}
+
+			cycle := g.findCycle(component, spec)
+			if cycle == nil {
+				continue
+			}
+			// A cycle with a single anti-dependency is a G-single, not a G2.
+			if base == G2 && countKind(cycle, RW) < 2 {
+				continue
+			}
+
+			found[base] = true
+			c.reportCycle(spec.kind, cycle)
+		}
+	}
+}
+
+// buildGraph infers the dependencies between the transactions.
+func (c *checker) buildGraph() *graph {
+	g := &graph{edges: map[int][]Edge{}}
+
+	// Committed transactions take part, and so do the transactions of unknown
+	// outcome whose appends were read, as they must have committed.
+	included := make([]bool, len(c.history))
+	for t, txn := range c.history {
+		included[t] = txn.Status == StatusOk
+	}
+	for _, key := range c.keys {
+		for _, value := range c.orders[key] {
+			if write, exists := c.writes[key][value]; exists && c.history[write.txn].Status == StatusUnknown {
+				included[write.txn] = true
+			}
+		}
+	}
+	for t := range c.history {
+		if included[t] {
+			g.nodes = append(g.nodes, t)
+		}
+	}
+
+	// writer provides the transaction that appended the given value, if it takes part.
+	writer := func(key string, value int) (int, bool) {
+		write, exists := c.writes[key][value]
+		if !exists || !included[write.txn] {
+			return 0, false
+		}
+		return write.txn, true
+	}
+
+	// Write dependencies follow the order of the values of every key.
+	for _, key := range c.keys {
+		order := c.orders[key]
+		for i := 1; i < len(order); i++ {
+			from, ok1 := writer(key, order[i-1])
+			to, ok2 := writer(key, order[i])
+			if ok1 && ok2 {
+				g.add(Edge{From: from, To: to, Kind: WW, Key: key})
+			}
+		}
+	}
+
+	// Read dependencies come from the last value of every read, and
+	// anti-dependencies go to the value that follows it.
+	c.reads(func(t, _ int, op MicroOp) {
+		order := c.orders[op.Key]
+		// Reads that disagree with the order are reported already.
+		if !isPrefix(op.List, order) {
+			return
+		}
+
+		if len(op.List) > 0 {
+			if from, ok := writer(op.Key, op.List[len(op.List)-1]); ok {
+				g.add(Edge{From: from, To: t, Kind: WR, Key: op.Key})
+			}
+		}
+		if len(op.List) < len(order) {
+			if to, ok := writer(op.Key, order[len(op.List)]); ok {
+				g.add(Edge{From: t, To: to, Kind: RW, Key: op.Key})
+			}
+		}
+	})
+
+	// Real-time dependencies go from every committed transaction to the
+	// transactions invoked after it completed. Only the immediate ones are
+	// added, as the others follow from them.
+	for _, to := range g.nodes {
+		call := c.history[to].Call
+
+		// The latest invocation of a transaction that completed before this one was invoked.
+		var latest int64 = -1 << 63
+		for _, from := range g.nodes {
+			txn := c.history[from]
+			if txn.Status == StatusOk && txn.Return < call && txn.Call > latest {
+				latest = txn.Call
+			}
+		}
+
+		for _, from := range g.nodes {
+			txn := c.history[from]
+			if txn.Status == StatusOk && txn.Return < call && txn.Return > latest {
+				g.add(Edge{From: from, To: to, Kind: Realtime})
+			}
+		}
+	}
+
+	return g
+}
+
+// add an edge to the graph. Edges of a node to itself are left out.
+func (g *graph) add(edge Edge) {
+	if edge.From != edge.To {
+		g.edges[edge.From] = append(g.edges[edge.From], edge)
+	}
+}
+
+// components provides the strongly connected components of the graph that
+// may hold cycles, using Tarjan's algorithm.
+func (g *graph) components() [][]int {
+	index := map[int]int{}
+	lowLink := map[int]int{}
+	onStack := map[int]bool{}
+	var stack []int
+	var components [][]int
+
+	var visit func(node int)
+	visit = func(node int) {
+		index[node] = len(index)
+		lowLink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, edge := range g.edges[node] {
+			if _, visited := index[edge.To]; !visited {
+				visit(edge.To)
+				lowLink[node] = minInt(lowLink[node], lowLink[edge.To])
+			} else if onStack[edge.To] {
+				lowLink[node] = minInt(lowLink[node], index[edge.To])
+			}
+		}
+
+		// The node is the root of a component.
+		if lowLink[node] == index[node] {
+			var component []int
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == node {
+					break
+				}
+			}
+			// A single node never has a cycle, as it has no edge to itself.
+			if len(component) > 1 {
+				components = append(components, component)
+			}
+		}
+	}
+
+	for _, node := range g.nodes {
+		if _, visited := index[node]; !visited {
+			visit(node)
+		}
+	}
+
+	return components
+}
+
+// findCycle searches the given component for a cycle as per the given spec.
+// It provides the shortest such cycle through the first matching edge that has
+// one that passes every transaction once.
+func (g *graph) findCycle(component []int, spec cycleSpec) []Edge {
+	members := map[int]bool{}
+	for _, node := range component {
+		members[node] = true
+	}
+
+	for _, node := range component {
+		for _, edge := range g.edges[node] {
+			if edge.Kind != spec.first || !members[edge.To] {
+				continue
+			}
+
+			// A cycle that passes a transaction twice is made of shorter cycles,
+			// like a G-single walked twice, which would look like a G2. Those
+			// shorter cycles are found on their own.
+			path := g.findPath(members, edge.To, edge.From, spec.rest, spec.required)
+			if cycle := append([]Edge{edge}, path...); path != nil && isSimple(cycle) {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// findPath searches for the shortest path between the given nodes, within the
+// given members, with edges of the given kinds only. If a kind is required,
+// the path must have at least one edge of it.
+func (g *graph) findPath(members map[int]bool, from, to int, kinds []EdgeKind, required EdgeKind) []Edge {
+	allowed := map[EdgeKind]bool{}
+	for _, kind := range kinds {
+		allowed[kind] = true
+	}
+
+	// The search runs over pairs of a node and whether the required kind was used.
+	type state struct {
+		node int
+		used bool
+	}
+	// step is the edge through which a state was reached, and the state before it.
+	type step struct {
+		edge Edge
+		prev state
+	}
+
+	start := state{node: from, used: required == ""}
+	steps := map[state]step{}
+	visited := map[state]bool{start: true}
+
+	queue := []state{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if current.node == to && current.used {
+			// Walk back to the start.
+			var path []Edge
+			for current != start {
+				path = append([]Edge{steps[current].edge}, path...)
+				current = steps[current].prev
+			}
+			return path
+		}
+
+		for _, edge := range g.edges[current.node] {
+			if !allowed[edge.Kind] || !members[edge.To] {
+				continue
+			}
+			next := state{node: edge.To, used: current.used || edge.Kind == required}
+			if !visited[next] {
+				visited[next] = true
+				steps[next] = step{edge: edge, prev: current}
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return nil
+}
+
+// reportCycle records a cycle anomaly. The edges of the cycle refer to history
+// indexes, which it converts to IDs.
+func (c *checker) reportCycle(kind AnomalyKind, cycle []Edge) {
+	edges := make([]Edge, len(cycle))
+	ids := make([]int, len(cycle))
+	texts := make([]string, len(cycle))
+	for i, edge := range cycle {
+		edge.From, edge.To = c.history[edge.From].ID, c.history[edge.To].ID
+		edges[i], ids[i] = edge, edge.From
+		texts[i] = edge.String()
+	}
+
+	c.anomalies = append(c.anomalies, Anomaly{
+		Kind:         kind,
+		Transactions: ids,
+		Cycle:        edges,
+		Description:  fmt.Sprintf("cycle %s", strings.Join(texts, ", ")),
+	})
+}
+
+// isSimple returns true if the given cycle passes every transaction once.
+func isSimple(cycle []Edge) bool {
+	seen := map[int]bool{}
+	for _, edge := range cycle {
+		if seen[edge.From] {
+			return false
+		}
+		seen[edge.From] = true
+	}
+	return true
+}
+
+// countKind counts the edges of the given kind.
+func countKind(edges []Edge, kind EdgeKind) int {
+	var count int
+	for _, edge := range edges {
+		if edge.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
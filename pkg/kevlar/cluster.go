@@ -0,0 +1,93 @@
+package kevlar
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+)
+
+func init() {
+	simulation.Register("kevlar", NewCluster)
+}
+
+// clusterOptions tell how the nodes of a Kevlar cluster behave. Other than the
+// default ones, they are only kept to demonstrate the problems that Kevlar used to have,
+// so the clusters with other options are only used by the scenarios of this package.
+type clusterOptions struct {
+	// leaseClock measures the leases of the locks of the keepers.
+	leaseClock leaseClock
+	// readRepair makes reads write the value they return back to the keepers.
+	readRepair bool
+	// newStorage creates the storage of the keeper of the given node.
+	newStorage func(id simulation.NodeID) (Storage, error)
+}
+
+// defaultClusterOptions are the options of the Kevlar cluster. Its keepers persist their
+// records to a write-ahead log and snapshots in memory, which survive their restarts.
+var defaultClusterOptions = clusterOptions{
+	leaseClock: monotonicLeases,
+	readRepair: true,
+	newStorage: newMemoryStorage,
+}
+
+// NewCluster creates a Kevlar cluster with the given number of nodes.
+// Every node runs both an internal and an external API.
+func NewCluster(nodeCount int) []simulation.ExternalAPI {
+	return newCluster(nodeCount, defaultClusterOptions)
+}
+
+// newWallClockLocksCluster creates a Kevlar cluster whose keepers measure the leases of
+// their locks with the wall clocks of the writers, like Kevlar used to. Writers with
+// clock offsets that differ by more than a lease take over each other's locks.
+//
+// It is only kept to demonstrate the problem. See the lock scenarios of this package.
+func newWallClockLocksCluster(nodeCount int) []simulation.ExternalAPI {
+	options := defaultClusterOptions
+	options.leaseClock = callerWallClockLeases
+	return newCluster(nodeCount, options)
+}
+
+// newNoReadRepairCluster creates a Kevlar cluster whose reads return the value of the last
+// write without confirming it to the keepers, like Kevlar used to. A value that a read returned
+// is lost if the keepers that the reader saw it on lose their state. Its keepers keep their
+// records in memory, so that they lose their state when they restart with amnesia.
+//
+// It is only kept to demonstrate the problem. See the read repair scenarios of this package.
+func newNoReadRepairCluster(nodeCount int) []simulation.ExternalAPI {
+	options := defaultClusterOptions
+	options.readRepair = false
+	options.newStorage = newVolatileStorage
+	return newCluster(nodeCount, options)
+}
+
+// newInMemoryCluster creates a Kevlar cluster whose keepers keep their records in memory only,
+// like Kevlar used to. A keeper that restarts with amnesia loses them, and so a write that only
+// a bare majority of keepers holds is lost.
+//
+// It is only kept to demonstrate the problem. See the durability scenarios of this package.
+func newInMemoryCluster(nodeCount int) []simulation.ExternalAPI {
+	options := defaultClusterOptions
+	options.newStorage = newVolatileStorage
+	return newCluster(nodeCount, options)
+}
+
+// newCluster creates a Kevlar cluster whose nodes behave as per the given options.
+//
+// It panics if the storage of a keeper cannot be created, as a cluster factory cannot
+// return an error.
+func newCluster(nodeCount int, options clusterOptions) []simulation.ExternalAPI {
+	internalAPIs := make([]*Internal, nodeCount)
+	externalAPIs := make([]simulation.ExternalAPI, nodeCount)
+
+	for i := 0; i < nodeCount; i++ {
+		storage, err := options.newStorage(simulation.NodeID(i))
+		if err != nil {
+			panic(fmt.Sprintf("kevlar: cannot create the storage of keeper %d: %v", i, err))
+		}
+		internalAPIs[i] = newInternal(simulation.NodeID(i), options.leaseClock, storage)
+	}
+	for i := 0; i < nodeCount; i++ {
+		externalAPIs[i] = newExternal(simulation.NodeID(i), internalAPIs, options.readRepair)
+	}
+
+	return externalAPIs
+}
@@ -5,26 +5,58 @@ import (
 	"contester/pkg/utils"
 	"errors"
 	"math"
-
-	"github.com/google/uuid"
 )
 
-// External implements the simulation.External interface using Kevlar.
+// External implements the simulation.CASExternalAPI and simulation.KeyedExternalAPI interfaces using Kevlar.
+// Every key is an independent record, with its own locks on the keepers, so it can be used as a key-value store.
 // Read the method descriptions to understand the algorithm.
 //
 // Note that this implementation guarantees consensus.
 type External struct {
+	// ID of the node that this API runs on.
+	ID           simulation.NodeID
 	InternalAPIs []*Internal
+	// readRepair makes reads write the value they return back to the keepers.
+	readRepair bool
+}
+
+func NewExternal(id simulation.NodeID, internalAPIs []*Internal) *External {
+	return newExternal(id, internalAPIs, true)
 }
 
-func NewExternal(internalAPIs []*Internal) *External {
-	return &External{InternalAPIs: internalAPIs}
+// newExternal creates an external API whose reads repair the keepers if readRepair is true.
+func newExternal(id simulation.NodeID, internalAPIs []*Internal, readRepair bool) *External {
+	return &External{ID: id, InternalAPIs: internalAPIs, readRepair: readRepair}
 }
 
-// Get TODO
+// stateKey is the key of the single register of the simulation.ExternalAPI interface.
+const stateKey = "state"
+
+// Get implements the simulation.ExternalAPI interface using the GetKey method.
 func (e *External) Get(ctx simulation.Context) (string, error) {
+	return e.GetKey(ctx, stateKey)
+}
+
+// Set implements the simulation.ExternalAPI interface using the SetKey method.
+func (e *External) Set(ctx simulation.Context, state string) error {
+	return e.SetKey(ctx, stateKey, state)
+}
+
+// CompareAndSet implements the simulation.CASExternalAPI interface using the CompareAndSetKey method.
+func (e *External) CompareAndSet(ctx simulation.Context, expected string, state string) (bool, error) {
+	return e.CompareAndSetKey(ctx, stateKey, expected, state)
+}
+
+// GetKey provides the value of the given key.
+// It reads the records of the key from all keepers, and determines the value from them without any locks.
+//
+// If the last write succeeded, its value is still unconfirmed in the records, and a majority of keepers
+// is all that holds it. So, before it is returned, the record is written back to all keepers, and a majority
+// of them must acknowledge it. A value that was returned once then survives the loss of the keepers that
+// the reader saw it on, and it cannot be un-returned by a later read.
+func (e *External) GetKey(ctx simulation.Context, key string) (string, error) {
 	// Get state values from all keepers.
-	records, errs := e.getStateFromAll(ctx)
+	records, errs := e.getStateFromAll(ctx, key)
 	// If majority failed, end execution right away.
 	if len(errs) >= utils.GetSmallestMajority(len(e.InternalAPIs)) {
 		return "", errors.Join(errs...)
@@ -35,7 +67,14 @@ func (e *External) Get(ctx simulation.Context) (string, error) {
 	// Taking action based on the LWS.
 	switch lws {
 	case "success":
+		// Confirm the value to a majority of keepers before returning it.
+		if e.readRepair {
+			if errRepair := e.repairStateOnAll(ctx, key, state); len(errRepair) >= utils.GetSmallestMajority(len(e.InternalAPIs)) {
+				return "", errors.Join(errRepair...)
+			}
+		}
 		return state.UnconfirmedValue, nil
+	// The confirmed value needs no repair, as every record of the highest version carries it.
 	case "failure":
 		return state.ConfirmedValue, nil
 	case "unknown":
@@ -46,24 +85,45 @@ func (e *External) Get(ctx simulation.Context) (string, error) {
 
 }
 
-// Set TODO
-func (e *External) Set(ctx simulation.Context, state string) error {
+// SetKey sets the value of the given key.
+// It locks the key on all keepers, determines the current record, and writes the new record on top of it.
+// Only the given key is locked, so writes to other keys run concurrently.
+func (e *External) SetKey(ctx simulation.Context, key string, state string) error {
+	// A plain write is a conditional write whose condition always holds.
+	_, err := e.write(ctx, key, func(string) bool { return true }, state)
+	return err
+}
+
+// CompareAndSetKey sets the value of the given key only if its current value is the expected one.
+//
+// It runs like SetKey, with the key locked on the keepers. The current value is
+// determined from the records the same way as the value for a GetKey. If it is not
+// the expected one, the keepers are unlocked without any write, and false is returned.
+func (e *External) CompareAndSetKey(ctx simulation.Context, key string, expected string, state string) (bool, error) {
+	return e.write(ctx, key, func(current string) bool { return current == expected }, state)
+}
+
+// write sets the value of the given key, if the given condition holds for its current value.
+// It reports whether the value was set.
+func (e *External) write(ctx simulation.Context, key string, condition func(current string) bool, state string) (bool, error) {
 	// Generate a new lockID.
-	lockID := uuid.NewString()
+	lockID := ctx.NewID()
 	smMajority := utils.GetSmallestMajority(len(e.InternalAPIs))
 
 	// Get state from all keepers and lock them for writing.
-	records, errs := e.getAndLockStateFromAll(ctx, lockID)
+	records, errs := e.getAndLockStateFromAll(ctx, key, lockID)
 	// Unlock all keepers at the end, even if setAndUnlock passes, for safety.
-	defer func() { _ = e.unlockAll(ctx, lockID) }()
+	defer func() { _ = e.unlockAll(ctx, key, lockID) }()
 
 	// If majority failed, end execution.
 	if len(errs) >= smMajority {
-		return errors.Join(errs...)
+		return false, errors.Join(errs...)
 	}
 
 	// This record will be set on all the State-Keepers.
-	newState := &record{Key: "state"}
+	newState := &record{Key: key}
+	// This will hold the current state of the system, which the condition is checked against.
+	var current string
 
 	// Determining the status of the last write request. It is equivalent to defining the state of the system.
 	lws, currentState := e.determineLWS(records)
@@ -74,31 +134,59 @@ func (e *External) Set(ctx simulation.Context, state string) error {
 	// to do with this request.
 	case "success":
 		// Form the new state.
+		current = currentState.UnconfirmedValue
 		newState.ConfirmedValue = currentState.UnconfirmedValue
 		newState.UnconfirmedValue = state
 		newState.Version = currentState.Version + 1
-		newState.Signature = uuid.NewString()
+		newState.Signature = ctx.NewID()
 	// If the last write request was unsuccessful, we retain the last confirmed value and version.
 	case "failure":
 		// Form the new state.
+		current = currentState.ConfirmedValue
 		newState.ConfirmedValue = currentState.ConfirmedValue
 		newState.UnconfirmedValue = state
 		newState.Version = currentState.Version
-		newState.Signature = uuid.NewString()
+		newState.Signature = ctx.NewID()
 	case "unknown":
-		return errors.Join(errs...)
+		return false, errors.Join(errs...)
 	default:
-		return errors.Join(errs...)
+		return false, errors.Join(errs...)
+	}
+
+	// If the condition does not hold, nothing is written. The deferred unlock releases the keepers.
+	if !condition(current) {
+		return false, nil
 	}
 
 	// Setting the new state in all State-Keepers.
-	errSet := e.setAndUnlockStateOnAll(ctx, newState, lockID)
+	errSet := e.setAndUnlockStateOnAll(ctx, key, newState, lockID)
 	// If a majority of keepers reject, we consider the operation failed.
 	if len(errSet) >= smMajority {
-		return errors.Join(errSet...)
+		return false, errors.Join(errSet...)
 	}
 
 	// Value successfully written. It is now guaranteed to be promoted to the ConfirmedValue eventually.
+	return true, nil
+}
+
+// Restart implements the simulation.Restartable interface.
+// It wipes the State-Keeper that runs on the same node as this API.
+func (e *External) Restart() {
+	for _, iAPI := range e.InternalAPIs {
+		if iAPI.id == e.ID {
+			iAPI.restart()
+		}
+	}
+}
+
+// Close implements the simulation.Closer interface.
+// It closes the storage of the State-Keeper that runs on the same node as this API.
+func (e *External) Close() error {
+	for _, iAPI := range e.InternalAPIs {
+		if iAPI.id == e.ID {
+			return iAPI.close()
+		}
+	}
 	return nil
 }
 
@@ -165,26 +253,23 @@ func (e *External) determineLWS(records []*record) (string, *record) {
 	return "unknown", nil
 }
 
-// getStateFromAll gets the records from all keepers concurrently.
-func (e *External) getStateFromAll(ctx simulation.Context) ([]*record, []error) {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan func() (*record, error), len(e.InternalAPIs))
-	defer close(respChan)
+// getStateFromAll gets the records of the given key from all keepers concurrently.
+func (e *External) getStateFromAll(ctx simulation.Context, key string) ([]*record, []error) {
+	// This slice will store the result of the internal API calls, by keeper.
+	results := make([]func() (*record, error), len(e.InternalAPIs))
 
-	// Looping over all internal APIs and getting the state from them all.
-	for _, iAPI := range e.InternalAPIs {
-		go func(iAPI *Internal) {
-			value, err := iAPI.get(ctx, "state")
-			respChan <- func() (*record, error) { return value, err }
-		}(iAPI)
-	}
+	// Calling all internal APIs concurrently and getting the state from them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		value, err := e.InternalAPIs[i].get(ctx, e.ID, key)
+		results[i] = func() (*record, error) { return value, err }
+	})
 
 	var errs []error
 	var records []*record
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		value, err := (<-respChan)()
+	for _, result := range results {
+		value, err := result()
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -195,26 +280,23 @@ func (e *External) getStateFromAll(ctx simulation.Context) ([]*record, []error)
 	return records, errs
 }
 
-// getAndLockStateFromAll gets records from all keepers concurrently and locks them for writing.
-func (e *External) getAndLockStateFromAll(ctx simulation.Context, lockID string) ([]*record, []error) {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan func() (*record, error), len(e.InternalAPIs))
-	defer close(respChan)
+// getAndLockStateFromAll gets the records of the given key from all keepers concurrently and locks the key for writing.
+func (e *External) getAndLockStateFromAll(ctx simulation.Context, key string, lockID string) ([]*record, []error) {
+	// This slice will store the result of the internal API calls, by keeper.
+	results := make([]func() (*record, error), len(e.InternalAPIs))
 
-	// Looping over all internal APIs and getting the state from them all.
-	for _, iAPI := range e.InternalAPIs {
-		go func(iAPI *Internal) {
-			value, err := iAPI.getAndLock(ctx, "state", lockID)
-			respChan <- func() (*record, error) { return value, err }
-		}(iAPI)
-	}
+	// Calling all internal APIs concurrently and getting the state from them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		value, err := e.InternalAPIs[i].getAndLock(ctx, e.ID, key, lockID)
+		results[i] = func() (*record, error) { return value, err }
+	})
 
 	var errs []error
 	var records []*record
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		value, err := (<-respChan)()
+	for _, result := range results {
+		value, err := result()
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -225,24 +307,20 @@ func (e *External) getAndLockStateFromAll(ctx simulation.Context, lockID string)
 	return records, errs
 }
 
-// setAndUnlockStateOnAll sets the given record in all keepers and unlocks them for writing.
-func (e *External) setAndUnlockStateOnAll(ctx simulation.Context, rec *record, lockID string) []error {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan error, len(e.InternalAPIs))
-	defer close(respChan)
-
-	// Looping over all internal APIs and getting the state from them all.
-	for i, iAPI := range e.InternalAPIs {
-		go func(i int, iAPI *Internal) {
-			respChan <- iAPI.setAndUnlock(ctx, "state", rec, lockID)
-		}(i, iAPI)
-	}
+// setAndUnlockStateOnAll sets the given record of the given key in all keepers and unlocks the key for writing.
+func (e *External) setAndUnlockStateOnAll(ctx simulation.Context, key string, rec *record, lockID string) []error {
+	// This slice will store the result of the internal API calls, by keeper.
+	results := make([]error, len(e.InternalAPIs))
+
+	// Calling all internal APIs concurrently and setting the state on them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		results[i] = e.InternalAPIs[i].setAndUnlock(ctx, e.ID, key, rec, lockID)
+	})
 
 	var errs []error
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		err := <-respChan
+	for _, err := range results {
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -251,24 +329,42 @@ func (e *External) setAndUnlockStateOnAll(ctx simulation.Context, rec *record, l
 	return errs
 }
 
-// unlockAll unlocks all keepers.
-func (e *External) unlockAll(ctx simulation.Context, lockID string) []error {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan error, len(e.InternalAPIs))
-	defer close(respChan)
-
-	// Looping over all internal APIs and getting the state from them all.
-	for i, iAPI := range e.InternalAPIs {
-		go func(i int, iAPI *Internal) {
-			respChan <- iAPI.unlock(ctx, "state", lockID)
-		}(i, iAPI)
+// repairStateOnAll writes the given record of the given key back to all keepers, unless they hold a newer one.
+func (e *External) repairStateOnAll(ctx simulation.Context, key string, rec *record) []error {
+	// This slice will store the result of the internal API calls, by keeper.
+	results := make([]error, len(e.InternalAPIs))
+
+	// Calling all internal APIs concurrently and repairing them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		results[i] = e.InternalAPIs[i].repair(ctx, e.ID, key, rec)
+	})
+
+	var errs []error
+
+	// Looping again to collect results.
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
+	return errs
+}
+
+// unlockAll unlocks the given key on all keepers.
+func (e *External) unlockAll(ctx simulation.Context, key string, lockID string) []error {
+	// This slice will store the result of the internal API calls, by keeper.
+	results := make([]error, len(e.InternalAPIs))
+
+	// Calling all internal APIs concurrently and unlocking them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		results[i] = e.InternalAPIs[i].unlock(ctx, e.ID, key, lockID)
+	})
+
 	var errs []error
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		err := <-respChan
+	for _, err := range results {
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -0,0 +1,300 @@
+package kevlar
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// walFileName is the name of the write-ahead log in the directory of a FileStorage.
+	walFileName = "wal.log"
+	// snapshotFileName is the name of the snapshot in the directory of a FileStorage.
+	snapshotFileName = "snapshot.json"
+	// snapshotInterval is the number of WAL entries after which they are compacted into a snapshot.
+	snapshotInterval = 64
+)
+
+// walEntry is a line of the write-ahead log.
+type walEntry struct {
+	Key   string
+	Value []byte
+}
+
+// FileStorage implements the Storage interface with files in a directory.
+//
+// Every Put appends an entry to a write-ahead log, and syncs it to the disk before
+// it returns. Once the log has snapshotInterval entries, the latest value of every
+// key is written to a snapshot, which replaces the log. Loading reads the snapshot,
+// and replays the log on top of it.
+//
+// A log entry that was torn by a crash in the middle of a Put is dropped, as that
+// Put never returned. A Put that fails to write or sync its entry truncates the
+// log back to where it was, so that the next entries do not follow torn bytes. If
+// even that fails, the storage refuses all Puts until it is loaded again.
+type FileStorage struct {
+	dir string
+
+	// entries holds the latest value of every key. Snapshots are written from it.
+	entries map[string][]byte
+	// wal is the open write-ahead log, nil once the storage is closed.
+	wal *os.File
+	// walEntries is the number of entries in the write-ahead log.
+	walEntries int
+	// walSize is the size of the write-ahead log, up to the end of its last entry.
+	walSize int64
+	// failed is the error of a Put that left a torn entry in the log, which
+	// fails all later Puts. Loading the storage drops the torn entry, and resets it.
+	failed   error
+	walMutex *sync.Mutex
+}
+
+// NewFileStorage opens the storage in the given directory, and creates the directory if needed.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create storage directory: %w", err)
+	}
+
+	s := &FileStorage{dir: dir, walMutex: &sync.Mutex{}}
+	// Read the state, which also drops a torn entry at the end of the log.
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(s.path(walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open write-ahead log: %w", err)
+	}
+	s.wal = wal
+
+	return s, nil
+}
+
+// Load implements the Storage interface. It reads the files again, so it provides
+// only what was made durable, like a restarted process would.
+func (s *FileStorage) Load() (map[string][]byte, error) {
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	if s.wal == nil {
+		return nil, errStorageClosed
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	// The caller gets its own map, as the storage keeps updating its entries.
+	entries := make(map[string][]byte, len(s.entries))
+	for key, value := range s.entries {
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// Put implements the Storage interface.
+func (s *FileStorage) Put(key string, value []byte) error {
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	if s.wal == nil {
+		return errStorageClosed
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+
+	line, err := encodeLogEntry(key, value)
+	if err != nil {
+		return err
+	}
+
+	// The entry is durable once it is synced.
+	if _, err := s.wal.Write(line); err != nil {
+		return s.discardEntry(fmt.Errorf("cannot write log entry: %w", err))
+	}
+	if err := s.wal.Sync(); err != nil {
+		return s.discardEntry(fmt.Errorf("cannot sync log entry: %w", err))
+	}
+
+	s.entries[key] = value
+	s.walEntries++
+	s.walSize += int64(len(line))
+
+	// A failed snapshot leaves the log in place, and is retried after the next entry.
+	if s.walEntries >= snapshotInterval {
+		_ = s.snapshot()
+	}
+	return nil
+}
+
+// Close implements the Storage interface.
+func (s *FileStorage) Close() error {
+	s.walMutex.Lock()
+	defer s.walMutex.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+
+	err := s.wal.Close()
+	s.wal = nil
+	return err
+}
+
+// discardEntry truncates the write-ahead log back to the end of its last entry,
+// after a Put failed with the given error, which it returns. The failed entry may
+// be torn, and an entry that follows it would not be readable anymore.
+//
+// If the log cannot be truncated, the storage is marked failed.
+// The caller must hold the mutex.
+func (s *FileStorage) discardEntry(errPut error) error {
+	// The log is appended to, so the next entry follows the truncated end.
+	if err := os.Truncate(s.path(walFileName), s.walSize); err != nil {
+		s.failed = fmt.Errorf("storage failed, as a torn log entry could not be discarded: %w",
+			errors.Join(errPut, err))
+		return s.failed
+	}
+	return errPut
+}
+
+// recover reads the snapshot and the write-ahead log into the entries of the storage.
+// It truncates a torn entry off the end of the log, so that new entries follow valid ones.
+func (s *FileStorage) recover() error {
+	entries := map[string][]byte{}
+
+	// The snapshot holds the entries of all compacted logs.
+	snapshot, err := os.ReadFile(s.path(snapshotFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot read snapshot: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(snapshot, &entries); err != nil {
+			return fmt.Errorf("cannot decode snapshot: %w", err)
+		}
+	}
+
+	wal, err := os.ReadFile(s.path(walFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot read write-ahead log: %w", err)
+	}
+
+	valid, count, err := replayLog(entries, wal)
+	if err != nil {
+		return err
+	}
+
+	if valid < len(wal) {
+		if err := os.Truncate(s.path(walFileName), int64(valid)); err != nil {
+			return fmt.Errorf("cannot truncate torn log entry: %w", err)
+		}
+	}
+
+	s.entries = entries
+	s.walEntries = count
+	s.walSize = int64(valid)
+	s.failed = nil
+	return nil
+}
+
+// snapshot writes all entries to a new snapshot, and empties the write-ahead log.
+//
+// The snapshot replaces the old one atomically, by a rename. If the log cannot be
+// emptied after that, replaying it on top of the new snapshot does no harm, as
+// its entries are in the snapshot already.
+func (s *FileStorage) snapshot() error {
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+
+	// Write the snapshot to a temporary file first, so that a crash never leaves a partial snapshot.
+	tmp := s.path(snapshotFileName + ".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path(snapshotFileName)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	// The log is appended to, so it can be emptied in place.
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	s.walEntries = 0
+	s.walSize = 0
+	return s.wal.Sync()
+}
+
+// encodeLogEntry encodes the given value of the given key as a line of the write-ahead log.
+func encodeLogEntry(key string, value []byte) ([]byte, error) {
+	line, err := json.Marshal(walEntry{Key: key, Value: value})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode log entry: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// replayLog applies the entries of the given write-ahead log to the given entries. It
+// provides the length of the valid part of the log and the number of entries in it.
+// Only the last line can lack the line break, if it was torn, and it is left out.
+func replayLog(entries map[string][]byte, wal []byte) (valid int, count int, err error) {
+	for valid < len(wal) {
+		end := bytes.IndexByte(wal[valid:], '\n')
+		if end < 0 {
+			break
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(wal[valid:valid+end], &entry); err != nil {
+			return 0, 0, fmt.Errorf("cannot decode log entry %d: %w", count+1, err)
+		}
+		entries[entry.Key] = entry.Value
+
+		valid += end + 1
+		count++
+	}
+
+	return valid, count, nil
+}
+
+// path provides the path of the given file in the directory of the storage.
+func (s *FileStorage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// writeFileSync writes the given file, and syncs it to the disk.
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir syncs the given directory, so that a rename in it is durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	return errors.Join(err, dir.Close())
+}
@@ -0,0 +1,127 @@
+package kevlar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openFileStorage opens a storage in the given directory, and closes it at the end of the test.
+func openFileStorage(t *testing.T, dir string) *FileStorage {
+	s, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// mustPut puts the given values into the given storage.
+func mustPut(t *testing.T, s *FileStorage, entries map[string]string) {
+	t.Helper()
+
+	for key, value := range entries {
+		if err := s.Put(key, []byte(value)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+}
+
+// assertLoads asserts that the given storage loads the given values.
+func assertLoads(t *testing.T, s *FileStorage, want map[string]string) {
+	t.Helper()
+
+	entries, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	got := map[string]string{}
+	for key, value := range entries {
+		got[key] = string(value)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want %v", got, want)
+	}
+}
+
+func TestFileStorageDropsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStorage(t, dir)
+	mustPut(t, s, map[string]string{"a": "1", "b": "2"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash in the middle of a Put leaves a line without a line break.
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.WriteString(`{"Key":"c","Val`); err != nil {
+		t.Fatal(err)
+	}
+	_ = wal.Close()
+
+	s = openFileStorage(t, dir)
+	assertLoads(t, s, map[string]string{"a": "1", "b": "2"})
+
+	// New entries follow the valid ones.
+	mustPut(t, s, map[string]string{"c": "3"})
+	_ = s.Close()
+	assertLoads(t, openFileStorage(t, dir), map[string]string{"a": "1", "b": "2", "c": "3"})
+}
+
+func TestFileStorageDiscardsFailedPut(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStorage(t, dir)
+	mustPut(t, s, map[string]string{"a": "1"})
+
+	// The write of the next Put fails after it wrote a part of its entry.
+	good := s.wal
+	if _, err := good.WriteString(`{"Key":"b","Val`); err != nil {
+		t.Fatal(err)
+	}
+	readOnly, err := os.Open(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.wal = readOnly
+	if err := s.Put("b", []byte("2")); err == nil {
+		t.Fatal("Put() error = nil, want a failed write")
+	}
+	s.wal = good
+	_ = readOnly.Close()
+
+	// The storage works on, and the torn entry is gone.
+	mustPut(t, s, map[string]string{"c": "3"})
+	_ = s.Close()
+	assertLoads(t, openFileStorage(t, dir), map[string]string{"a": "1", "c": "3"})
+}
+
+func TestFileStorageSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStorage(t, dir)
+
+	// Overwrite a few keys for more entries than a snapshot takes.
+	want := map[string]string{}
+	for n := 0; n < snapshotInterval+10; n++ {
+		key := fmt.Sprintf("key-%d", n%5)
+		want[key] = fmt.Sprint(n)
+		mustPut(t, s, map[string]string{key: want[key]})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("no snapshot after %d entries: %v", snapshotInterval, err)
+	}
+	if s.walEntries != 10 {
+		t.Errorf("write-ahead log has %d entries after the snapshot, want 10", s.walEntries)
+	}
+
+	// Loading replays the log on top of the snapshot.
+	assertLoads(t, s, want)
+	_ = s.Close()
+	assertLoads(t, openFileStorage(t, dir), want)
+}
@@ -2,16 +2,47 @@ package kevlar
 
 import (
 	"contester/pkg/simulation"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
 const lockTimeout = time.Minute
 
+var (
+	// errLocked is returned if another writer holds the lock of the key.
+	errLocked = errors.New("key already locked")
+	// errNotLocked is returned if the lock of the writer has expired, or was dropped.
+	errNotLocked = errors.New("key not locked")
+	// errLockMismatch is returned if another writer has taken over the lock of the key.
+	errLockMismatch = errors.New("lock ID does not match")
+)
+
+// leaseClock reads the clock that measures the leases of the locks of a keeper.
+// Its readings are only ever compared with other readings of the same leaseClock.
+type leaseClock func(ctx simulation.Context, keeper simulation.NodeID) time.Duration
+
+// monotonicLeases measures leases with the monotonic clock of the keeper. The keeper
+// alone creates and checks its locks, so no other clock can disagree with it, and
+// neither clock offsets nor clock jumps change how long a lease lasts.
+func monotonicLeases(ctx simulation.Context, keeper simulation.NodeID) time.Duration {
+	return ctx.MonotonicOf(keeper)
+}
+
+// callerWallClockLeases measures leases with the wall clock of the node that sent the
+// request. Nodes whose clock offsets differ by more than lockTimeout disagree on whether
+// a lock is alive, so that one of them takes over the lock while its holder is still
+// writing. It is kept to demonstrate that in the scenarios.
+func callerWallClockLeases(ctx simulation.Context, _ simulation.NodeID) time.Duration {
+	return time.Duration(ctx.Time().UnixNano())
+}
+
 type lockInfo struct {
-	LockID    string
-	ExpiresAt time.Time
+	LockID string
+	// ExpiresAt is the reading of the lease clock of the keeper at which the lock expires.
+	ExpiresAt time.Duration
 }
 
 // record represents the data structure used by Kevlar to store a key-value pair.
@@ -30,56 +61,128 @@ type record struct {
 	Signature string
 }
 
+// Internal is a State-Keeper. It holds the records of all keys, and the locks that writers take on them.
+//
+// Every record is persisted to the storage of the keeper before it is acknowledged, and the records are
+// loaded back from it when the keeper restarts. The locks are leases, so they are kept in memory only.
+// A restarted keeper forgets them, as if they expired, and the writers that held them are fenced off by
+// their lock IDs.
 type Internal struct {
+	// id of the node that this keeper runs on.
+	id simulation.NodeID
+
 	store      map[string]*record
 	storeMutex *sync.RWMutex
 	keyLockMap map[string]*lockInfo
+	// leaseClock measures the leases of the locks in keyLockMap.
+	leaseClock leaseClock
+	// storage persists the records in store.
+	storage Storage
+}
+
+// NewInternal creates a keeper that keeps its records in memory only. It loses them when it restarts.
+func NewInternal(id simulation.NodeID) *Internal {
+	return newInternal(id, monotonicLeases, volatileStorage{})
+}
+
+// NewDurableInternal creates a keeper that persists its records to the given storage,
+// and loads the records that the storage holds already.
+func NewDurableInternal(id simulation.NodeID, storage Storage) (*Internal, error) {
+	i := newInternal(id, monotonicLeases, storage)
+	if err := i.recover(); err != nil {
+		return nil, err
+	}
+	return i, nil
 }
 
-func NewInternal() *Internal {
+// newInternal creates an empty keeper that measures the leases of its locks with the given clock,
+// and persists its records to the given storage.
+func newInternal(id simulation.NodeID, leaseClock leaseClock, storage Storage) *Internal {
 	return &Internal{
+		id:         id,
 		store:      map[string]*record{},
 		storeMutex: &sync.RWMutex{},
 		keyLockMap: map[string]*lockInfo{},
+		leaseClock: leaseClock,
+		storage:    storage,
 	}
 }
 
-func (i *Internal) get(ctx simulation.Context, key string) (*record, error) {
-	// Read lock.
-	i.storeMutex.RLock()
-	defer i.storeMutex.RUnlock()
+func (i *Internal) get(ctx simulation.Context, from simulation.NodeID, key string) (*record, error) {
+	rec, err := ctx.Deliver(from, i.id, func() (any, error) {
+		return i.handleGet(key), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rec.(*record), nil
+}
 
-	if err := ctx.NetworkOp(); err != nil {
+func (i *Internal) getAndLock(ctx simulation.Context, from simulation.NodeID, key string, lockID string) (*record, error) {
+	rec, err := ctx.Deliver(from, i.id, func() (any, error) {
+		return i.handleGetAndLock(ctx, key, lockID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	return rec.(*record), nil
+}
+
+func (i *Internal) setAndUnlock(ctx simulation.Context, from simulation.NodeID, key string, value *record, lockID string) error {
+	_, err := ctx.Deliver(from, i.id, func() (any, error) {
+		return nil, i.handleSetAndUnlock(ctx, key, value, lockID)
+	})
+	return err
+}
+
+func (i *Internal) repair(ctx simulation.Context, from simulation.NodeID, key string, value *record) error {
+	_, err := ctx.Deliver(from, i.id, func() (any, error) {
+		return nil, i.handleRepair(key, value)
+	})
+	return err
+}
+
+func (i *Internal) unlock(ctx simulation.Context, from simulation.NodeID, key string, lockID string) error {
+	_, err := ctx.Deliver(from, i.id, func() (any, error) {
+		return nil, i.handleUnlock(key, lockID)
+	})
+	return err
+}
+
+// handleGet runs on the keeper when a get request arrives.
+func (i *Internal) handleGet(key string) *record {
+	// Read lock.
+	i.storeMutex.RLock()
+	defer i.storeMutex.RUnlock()
+
 	rec, exists := i.store[key]
 	if !exists {
 		rec = &record{Key: key, Version: -1}
 	}
 
-	return rec, nil
+	return rec
 }
 
-func (i *Internal) getAndLock(ctx simulation.Context, key string, lockID string) (*record, error) {
+// handleGetAndLock runs on the keeper when a getAndLock request arrives.
+func (i *Internal) handleGetAndLock(ctx simulation.Context, key string, lockID string) (*record, error) {
 	// Write lock because of a potential write operation.
 	i.storeMutex.Lock()
 	defer i.storeMutex.Unlock()
 
-	if err := ctx.NetworkOp(); err != nil {
-		return nil, err
-	}
+	now := i.leaseClock(ctx, i.id)
 
 	lock, exists := i.keyLockMap[key]
 	// If lock exists and is not expired...
-	if exists && !ctx.Time().After(lock.ExpiresAt) {
-		return nil, errors.New("key already locked")
+	if exists && now <= lock.ExpiresAt {
+		return nil, errLocked
 	}
 
 	// Create a new lock record.
 	i.keyLockMap[key] = &lockInfo{
 		LockID:    lockID,
-		ExpiresAt: ctx.Time().Add(lockTimeout),
+		ExpiresAt: now + lockTimeout,
 	}
 
 	rec, exists := i.store[key]
@@ -90,22 +193,24 @@ func (i *Internal) getAndLock(ctx simulation.Context, key string, lockID string)
 	return rec, nil
 }
 
-func (i *Internal) setAndUnlock(ctx simulation.Context, key string, value *record, lockID string) error {
+// handleSetAndUnlock runs on the keeper when a setAndUnlock request arrives.
+func (i *Internal) handleSetAndUnlock(ctx simulation.Context, key string, value *record, lockID string) error {
 	// Write lock because of a potential write operation.
 	i.storeMutex.Lock()
 	defer i.storeMutex.Unlock()
 
-	if err := ctx.NetworkOp(); err != nil {
-		return err
-	}
-
 	lock, exists := i.keyLockMap[key]
 	// If lock does not exist or is expired...
-	if !exists || ctx.Time().After(lock.ExpiresAt) {
-		return errors.New("key not locked")
+	if !exists || i.leaseClock(ctx, i.id) > lock.ExpiresAt {
+		return errNotLocked
 	}
 	if lock.LockID != lockID {
-		return errors.New("lock ID does not match")
+		return errLockMismatch
+	}
+
+	// Persist the value first, as it is acknowledged once it is stored.
+	if err := i.persist(key, value); err != nil {
+		return err
 	}
 
 	// Unlock the key.
@@ -116,24 +221,95 @@ func (i *Internal) setAndUnlock(ctx simulation.Context, key string, value *recor
 	return nil
 }
 
-func (i *Internal) unlock(ctx simulation.Context, key string, lockID string) error {
+// handleRepair runs on the keeper when a repair request arrives.
+//
+// The given record is the one that a majority of keepers held when a reader saw it.
+// The keeper adopts it unless it holds a newer record already, which was built on top
+// of it. It ignores locks, as the writer that holds one has seen the record too.
+func (i *Internal) handleRepair(key string, value *record) error {
 	// Write lock because of a potential write operation.
 	i.storeMutex.Lock()
 	defer i.storeMutex.Unlock()
 
-	if err := ctx.NetworkOp(); err != nil {
+	rec, exists := i.store[key]
+	// A newer record confirms the given one already.
+	if exists && rec.Version > value.Version {
+		return nil
+	}
+
+	// A record of the same version with another signature is left over from a failed
+	// write, as a single signature can hold a majority of a version.
+	if err := i.persist(key, value); err != nil {
 		return err
 	}
+	i.store[key] = value
+	return nil
+}
+
+// handleUnlock runs on the keeper when an unlock request arrives.
+func (i *Internal) handleUnlock(key string, lockID string) error {
+	// Write lock because of a potential write operation.
+	i.storeMutex.Lock()
+	defer i.storeMutex.Unlock()
 
 	lock, exists := i.keyLockMap[key]
 	if !exists {
 		return nil
 	}
 	if lock.LockID != lockID {
-		return errors.New("lock ID does not match")
+		return errLockMismatch
 	}
 
 	// Unlock the key.
 	delete(i.keyLockMap, key)
 	return nil
 }
+
+// restart drops all the in-memory state of the keeper, like a crashed process would,
+// and loads the records back from the storage.
+//
+// A keeper that cannot load its records must not serve, as it would serve them as
+// missing. So, it panics, like a process that fails to start.
+func (i *Internal) restart() {
+	i.storeMutex.Lock()
+	defer i.storeMutex.Unlock()
+
+	i.keyLockMap = map[string]*lockInfo{}
+	if err := i.recover(); err != nil {
+		panic(fmt.Sprintf("kevlar: keeper %d cannot recover: %v", i.id, err))
+	}
+}
+
+// recover replaces the records of the keeper with the ones that its storage holds.
+func (i *Internal) recover() error {
+	values, err := i.storage.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load records: %w", err)
+	}
+
+	store := make(map[string]*record, len(values))
+	for key, value := range values {
+		rec := &record{}
+		if err := json.Unmarshal(value, rec); err != nil {
+			return fmt.Errorf("cannot decode the record of key %q: %w", key, err)
+		}
+		store[key] = rec
+	}
+
+	i.store = store
+	return nil
+}
+
+// persist writes the given record of the given key to the storage.
+func (i *Internal) persist(key string, rec *record) error {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("cannot encode the record of key %q: %w", key, err)
+	}
+	return i.storage.Put(key, value)
+}
+
+// close releases the storage of the keeper.
+func (i *Internal) close() error {
+	return i.storage.Close()
+}
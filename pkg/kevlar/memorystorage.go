@@ -0,0 +1,109 @@
+package kevlar
+
+import (
+	"contester/pkg/simulation"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// memoryStorage implements the Storage interface like FileStorage does, with a write-ahead
+// log and snapshots, but it keeps the bytes of both in memory instead of in files.
+//
+// The keepers of the simulation use it, as the simulation cannot let the virtual time pass
+// while a keeper waits on the disk. The bytes stand for what a disk would hold after a crash,
+// so a restarted keeper loads only what was put before, and a torn entry at the end of the
+// log is dropped, like FileStorage does.
+type memoryStorage struct {
+	// entries holds the latest value of every key. Snapshots are written from it.
+	entries map[string][]byte
+	// snapshot holds the bytes of the snapshot, nil if none was taken yet.
+	snapshot []byte
+	// wal holds the bytes of the write-ahead log.
+	wal []byte
+	// walEntries is the number of entries in the write-ahead log.
+	walEntries int
+	// closed is true once the storage is closed.
+	closed bool
+	mutex  *sync.Mutex
+}
+
+// newMemoryStorage provides an empty memoryStorage for the keeper of any node.
+func newMemoryStorage(simulation.NodeID) (Storage, error) {
+	return &memoryStorage{entries: map[string][]byte{}, mutex: &sync.Mutex{}}, nil
+}
+
+// Load implements the Storage interface. It decodes the bytes again, so it provides
+// only what was made durable, like a restarted process would.
+func (s *memoryStorage) Load() (map[string][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, errStorageClosed
+	}
+
+	// The snapshot holds the entries of all compacted logs.
+	entries := map[string][]byte{}
+	if s.snapshot != nil {
+		if err := json.Unmarshal(s.snapshot, &entries); err != nil {
+			return nil, fmt.Errorf("cannot decode snapshot: %w", err)
+		}
+	}
+
+	valid, count, err := replayLog(entries, s.wal)
+	if err != nil {
+		return nil, err
+	}
+	s.wal = s.wal[:valid]
+	s.walEntries = count
+	s.entries = entries
+
+	// The caller gets its own map, as the storage keeps updating its entries.
+	loaded := make(map[string][]byte, len(entries))
+	for key, value := range entries {
+		loaded[key] = value
+	}
+	return loaded, nil
+}
+
+// Put implements the Storage interface.
+func (s *memoryStorage) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return errStorageClosed
+	}
+
+	line, err := encodeLogEntry(key, value)
+	if err != nil {
+		return err
+	}
+
+	s.wal = append(s.wal, line...)
+	s.entries[key] = value
+	s.walEntries++
+
+	// Compact the log into a snapshot, which replaces the old one at once.
+	if s.walEntries >= snapshotInterval {
+		snapshot, err := json.Marshal(s.entries)
+		if err != nil {
+			// The log is left in place, and the snapshot is retried after the next entry.
+			return nil
+		}
+		s.snapshot = snapshot
+		s.wal = nil
+		s.walEntries = 0
+	}
+	return nil
+}
+
+// Close implements the Storage interface.
+func (s *memoryStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	return nil
+}
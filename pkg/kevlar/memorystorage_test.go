@@ -0,0 +1,45 @@
+package kevlar
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storage, _ := newMemoryStorage(0)
+	s := storage.(*memoryStorage)
+
+	// Overwrite a few keys for more entries than a snapshot takes.
+	want := map[string][]byte{}
+	for n := 0; n < snapshotInterval+10; n++ {
+		key := fmt.Sprintf("key-%d", n%5)
+		want[key] = []byte(fmt.Sprint(n))
+		if err := s.Put(key, want[key]); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	if s.snapshot == nil || s.walEntries != 10 {
+		t.Errorf("write-ahead log has %d entries and a snapshot of %d bytes, want 10 entries after a snapshot",
+			s.walEntries, len(s.snapshot))
+	}
+
+	// A crash in the middle of a Put leaves a torn entry, which a restart drops.
+	s.wal = append(s.wal, `{"Key":"torn","Val`...)
+	loaded, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Load() = %v, want %v", loaded, want)
+	}
+
+	// New entries follow the valid ones.
+	want["key-0"] = []byte("new")
+	if err := s.Put("key-0", want["key-0"]); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if loaded, _ := s.Load(); !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Load() = %v, want %v", loaded, want)
+	}
+}
@@ -0,0 +1,249 @@
+package kevlar
+
+import (
+	"contester/pkg/nemesis"
+	"contester/pkg/scenario"
+	"contester/pkg/simulation"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	for _, s := range lockScenarios() {
+		scenario.Register(s)
+	}
+	for _, s := range readRepairScenarios() {
+		scenario.Register(s)
+	}
+	for _, s := range durabilityScenarios() {
+		scenario.Register(s)
+	}
+}
+
+// lockScenarios show that the locks of the keepers hold under clock skew, and
+// that they did not when their leases were measured with the wall clocks of the writers.
+func lockScenarios() []scenario.Scenario {
+	// A healthy network, so that every lost lock is due to the clocks.
+	conf := simulation.QuickStartConfig
+	conf.Seed = 1
+	conf.RequestCount = 30
+	conf.RequestInterval = 700 * time.Microsecond
+	conf.ReadRatio = 0.2
+	conf.NetworkFailureProbability = 0
+	conf.NetworkDuplicateProbability = 0
+	conf.PartitionKinds = nil
+	conf.CrashDuration = 0
+	conf.MaxClockJump = 0
+
+	// Clock offsets that differ by more than a lease.
+	offsets := conf
+	offsets.MaxClockOffset = 2 * lockTimeout
+
+	// Clocks that jump by more than a lease.
+	jumps := conf
+	jumps.MaxClockJump = 2 * lockTimeout
+	jumps.ClockJumpInterval = time.Millisecond
+
+	return []scenario.Scenario{
+		{
+			Name:        "kevlar/lock-offsets",
+			Description: "writers keep their locks, even if clock offsets differ by more than a lease",
+			Algorithm:   "kevlar",
+			NodeCount:   5,
+			Config:      offsets,
+			Sessions:    20,
+			Check:       checkLocksHeld,
+		},
+		{
+			Name:          "kevlar/lock-offsets-wall-clock",
+			Description:   "with leases on the wall clocks of the writers, writers lose their locks if clock offsets differ by more than a lease",
+			Algorithm:     "kevlar",
+			Cluster:       newWallClockLocksCluster,
+			NodeCount:     5,
+			Config:        offsets,
+			Sessions:      20,
+			Check:         checkLocksHeld,
+			ExpectFailure: true,
+		},
+		{
+			Name:        "kevlar/lock-clock-jumps",
+			Description: "writers keep their locks, even if clocks jump by more than a lease",
+			Algorithm:   "kevlar",
+			NodeCount:   5,
+			Config:      jumps,
+			Sessions:    20,
+			Check:       checkLocksHeld,
+		},
+		{
+			Name:          "kevlar/lock-clock-jumps-wall-clock",
+			Description:   "with leases on the wall clocks of the writers, writers lose their locks if clocks jump by more than a lease",
+			Algorithm:     "kevlar",
+			Cluster:       newWallClockLocksCluster,
+			NodeCount:     5,
+			Config:        jumps,
+			Sessions:      20,
+			Check:         checkLocksHeld,
+			ExpectFailure: true,
+		},
+	}
+}
+
+// checkLocksHeld fails a session if consensus was broken, or if a writer lost its lock
+// while writing, which means that another writer took the lock over or that it expired.
+func checkLocksHeld(report *simulation.Report, err error) error {
+	if err != nil {
+		return err
+	}
+
+	for _, op := range report.History.Operations {
+		if strings.Contains(op.Error, errLockMismatch.Error()) || strings.Contains(op.Error, errNotLocked.Error()) {
+			return fmt.Errorf("a writer lost its lock while writing: %s", op)
+		}
+	}
+	return nil
+}
+
+// amnesiaConfig provides a config in which writes reach only a bare majority of keepers,
+// as per the given schedule, and one of them loses its state.
+func amnesiaConfig(schedule string) simulation.Config {
+	// A healthy network, so that every fault is the one of the schedule.
+	conf := simulation.QuickStartConfig
+	conf.Seed = 1
+	conf.RequestCount = 24
+	conf.RequestInterval = 500 * time.Microsecond
+	conf.ReadRatio = 0.7
+	conf.NetworkFailureProbability = 0
+	conf.NetworkDuplicateProbability = 0
+	conf.NetworkReorderProbability = 0
+	conf.PartitionKinds = nil
+	conf.CrashDuration = 0
+	conf.MaxClockJump = 0
+	conf.Nemesis = nemesis.MustParse(schedule)
+	return conf
+}
+
+// readRepairScenarios show that a value that a read returned survives the loss of
+// a keeper that held it, and that it did not before reads repaired the keepers.
+//
+// Persisted keepers lose nothing when they restart, so the scenarios keep the records
+// of the keepers in memory, which stands for a keeper that lost its disk.
+func readRepairScenarios() []scenario.Scenario {
+	// The keeper loses its state after the partition healed, which reads can repair.
+	conf := amnesiaConfig(`
+		at 0 partition {0,1,2}|{3,4}
+		at 3ms heal
+		at 6ms crash node 0
+		at 6100us restart node 0 with amnesia
+	`)
+
+	return []scenario.Scenario{
+		{
+			Name:        "kevlar/read-repair",
+			Description: "a value that a read returned is never un-returned, even if a keeper that held it loses its state",
+			Algorithm:   "kevlar",
+			Cluster:     newInMemoryCluster,
+			NodeCount:   5,
+			Config:      conf,
+			Sessions:    50,
+			Check:       checkNoUnreturnedReads,
+		},
+		{
+			Name:          "kevlar/read-repair-disabled",
+			Description:   "without read repair, a value that a read returned is un-returned if a keeper that held it loses its state",
+			Algorithm:     "kevlar",
+			Cluster:       newNoReadRepairCluster,
+			NodeCount:     5,
+			Config:        conf,
+			Sessions:      50,
+			Check:         checkNoUnreturnedReads,
+			ExpectFailure: true,
+		},
+	}
+}
+
+// durabilityScenarios show that a write survives a keeper that restarts with amnesia,
+// and that it did not when the keepers kept their records in memory only.
+func durabilityScenarios() []scenario.Scenario {
+	// The keeper loses its state during the partition, so that no read can repair the others.
+	conf := amnesiaConfig(`
+		at 0 partition {0,1,2}|{3,4}
+		at 3ms crash node 0
+		at 3100us restart node 0 with amnesia
+		at 6ms heal
+	`)
+
+	return []scenario.Scenario{
+		{
+			Name:        "kevlar/crash-amnesia",
+			Description: "writes survive a keeper that restarts with amnesia, as keepers persist their records",
+			Algorithm:   "kevlar",
+			NodeCount:   5,
+			Config:      conf,
+			Sessions:    50,
+		},
+		{
+			Name:          "kevlar/crash-amnesia-in-memory",
+			Description:   "with records in memory only, writes are lost when a keeper that held them restarts with amnesia",
+			Algorithm:     "kevlar",
+			Cluster:       newInMemoryCluster,
+			NodeCount:     5,
+			Config:        conf,
+			Sessions:      50,
+			ExpectFailure: true,
+		},
+	}
+}
+
+// checkNoUnreturnedReads fails a session if a read returned a value, and a later read returned a value
+// that the first value had certainly overwritten, which is a value whose write completed before the
+// write of the first value was invoked. The initial empty value precedes every write.
+//
+// Unlike the linearizability check, it does not judge writes that no read has returned. A keeper that
+// keeps its records in memory may lose them.
+func checkNoUnreturnedReads(report *simulation.Report, _ error) error {
+	ops := report.History.Operations
+
+	// written provides the writes of every key by their values, including the ones that failed,
+	// as they may have taken effect.
+	written := map[string]map[string]simulation.Operation{}
+	for _, op := range ops {
+		isWrite := op.Kind == simulation.OperationSet || (op.Kind == simulation.OperationCAS && (op.Swapped || op.Failed()))
+		if !isWrite {
+			continue
+		}
+		if written[op.Key] == nil {
+			written[op.Key] = map[string]simulation.Operation{}
+		}
+		written[op.Key][op.Input] = op
+	}
+
+	// precedes tells whether the write of the first value completed before the write of the second was invoked.
+	precedes := func(key string, first string, second string) bool {
+		later, exists := written[key][second]
+		if !exists {
+			return false
+		}
+		if first == "" {
+			return true
+		}
+		earlier, exists := written[key][first]
+		return exists && !earlier.Failed() && earlier.CompleteIndex < later.InvokeIndex
+	}
+
+	for _, first := range ops {
+		if first.Kind != simulation.OperationGet || first.Failed() || first.Output == "" {
+			continue
+		}
+
+		for _, second := range ops {
+			if second.Kind != simulation.OperationGet || second.Failed() || second.Key != first.Key {
+				continue
+			}
+			if second.InvokeIndex > first.CompleteIndex && precedes(first.Key, second.Output, first.Output) {
+				return fmt.Errorf("a read un-returned a value. %s, then %s", first, second)
+			}
+		}
+	}
+	return nil
+}
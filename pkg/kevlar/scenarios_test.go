@@ -0,0 +1,30 @@
+package kevlar
+
+import (
+	"contester/pkg/scenario"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	names := scenario.Names()
+	if len(names) == 0 {
+		t.Fatal("scenario.Names() is empty, want the scenarios of kevlar")
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			s, err := scenario.Lookup(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := scenario.Run(s)
+			if err != nil {
+				t.Fatalf("scenario.Run() error = %v", err)
+			}
+			if !result.Ok {
+				t.Errorf("scenario %s failed after %d sessions: %v", name, result.Sessions, result.Failure)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package kevlar
+
+import (
+	"contester/pkg/simulation"
+	"errors"
+)
+
+// errStorageClosed is returned by the operations of a storage after it was closed.
+var errStorageClosed = errors.New("storage closed")
+
+// Storage persists the records of a keeper, so that they survive a restart.
+//
+// It is a durable map of keys to opaque values, which the keeper encodes itself,
+// so that any key-value store can back a keeper.
+type Storage interface {
+	// Load provides all values that were persisted so far, by their keys.
+	// A keeper calls it when it starts, and whenever it restarts.
+	Load() (map[string][]byte, error)
+	// Put persists the value of the given key. The value must be durable once it returns,
+	// as the keeper acknowledges the write right after.
+	Put(key string, value []byte) error
+	// Close releases the resources of the storage.
+	Close() error
+}
+
+// volatileStorage persists nothing, so a keeper that restarts comes back empty.
+// It is what Kevlar used to do, and what NewInternal still does.
+type volatileStorage struct{}
+
+func (volatileStorage) Load() (map[string][]byte, error) {
+	return map[string][]byte{}, nil
+}
+
+func (volatileStorage) Put(string, []byte) error {
+	return nil
+}
+
+func (volatileStorage) Close() error {
+	return nil
+}
+
+// newVolatileStorage provides a volatileStorage for the keeper of any node.
+func newVolatileStorage(simulation.NodeID) (Storage, error) {
+	return volatileStorage{}, nil
+}
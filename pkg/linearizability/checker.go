@@ -0,0 +1,265 @@
+package linearizability
+
+import (
+	"sort"
+)
+
+// DefaultBudget is the number of model steps after which Check gives up.
+const DefaultBudget = 10_000_000
+
+// Result of a linearizability check.
+type Result struct {
+	// Ok is true if the history is linearizable.
+	Ok bool
+	// Unknown is true if the search ran out of budget before it could decide. Ok
+	// is false then, although the history may well be linearizable.
+	Unknown bool
+	// Order holds indexes of the checked operations.
+	//
+	// If the history is linearizable, it is a legal sequential order of all
+	// operations. Otherwise, it is the longest legal sequential prefix that
+	// the checker could find, which points to where the history breaks.
+	Order []int
+}
+
+// Check decides whether the given history is linearizable with respect to the model.
+//
+// It implements the Wing & Gong search with the memoization proposed by Lowe,
+// the same approach as taken by Porcupine. The search is exponential in the
+// worst case, but it is fast for the histories produced by the simulation. It
+// gives up after DefaultBudget steps of the model, with an unknown result.
+func Check(model Model, history []Operation) Result {
+	return CheckWithBudget(model, history, DefaultBudget)
+}
+
+// CheckWithBudget is like Check, but it gives up after the given number of steps
+// of the model. A budget of zero or less means no limit.
+func CheckWithBudget(model Model, history []Operation, budget int) Result {
+	// An empty history is trivially linearizable.
+	if len(history) == 0 {
+		return Result{Ok: true}
+	}
+
+	// Build the doubly linked list of call and return entries.
+	head := makeEntries(history)
+
+	// The cache of (linearized set, state) pairs that have already been explored.
+	cache := map[uint64][]cacheEntry{}
+	// The stack of linearized calls, used for backtracking.
+	var calls []callFrame
+	// The longest sequence of linearized calls seen so far.
+	var longest []int
+	// The number of steps of the model so far.
+	var steps int
+
+	state := model.Init()
+	linearized := newBitset(len(history))
+
+	current := head.next
+	for head.next != nil {
+		// A return entry means that its call could not be linearized before it.
+		// So, undo the most recent linearization and try the next candidate.
+		if !current.isCall {
+			if len(calls) == 0 {
+				return Result{Ok: false, Order: longest}
+			}
+
+			top := calls[len(calls)-1]
+			calls = calls[:len(calls)-1]
+
+			state = top.state
+			linearized.clear(top.entry.op)
+			top.entry.unlift()
+
+			current = top.entry.next
+			continue
+		}
+
+		// Give up once the budget is spent. The steps are counted rather than the
+		// time, so that the result does not depend on the machine.
+		if steps++; budget > 0 && steps > budget {
+			return Result{Unknown: true, Order: longest}
+		}
+
+		// Try to linearize this call at this point.
+		legal, newState := model.Step(state, current.value, current.match.value)
+		if legal {
+			// The clone is owned by the cache, the working set is updated separately.
+			if cacheAdd(cache, model, linearized.clone().set(current.op), newState) {
+				calls = append(calls, callFrame{entry: current, state: state})
+				state = newState
+				linearized.set(current.op)
+				current.lift()
+
+				// Keep track of the deepest point the search has reached.
+				if len(calls) > len(longest) {
+					longest = framesToOrder(calls)
+				}
+
+				current = head.next
+				continue
+			}
+		}
+
+		current = current.next
+	}
+
+	return Result{Ok: true, Order: framesToOrder(calls)}
+}
+
+// entry is a node of the doubly linked list that holds the history events.
+type entry struct {
+	// isCall is true for invocation events and false for completion events.
+	isCall bool
+	// op is the index of the operation in the history.
+	op int
+	// value is the input of a call, or the output of a return.
+	value any
+	// match is the return entry of a call entry.
+	match *entry
+
+	prev, next *entry
+}
+
+// lift removes a call and its return from the list.
+func (e *entry) lift() {
+	e.prev.next = e.next
+	if e.next != nil {
+		e.next.prev = e.prev
+	}
+
+	ret := e.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift puts back a call and its return that were removed by lift.
+func (e *entry) unlift() {
+	ret := e.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+
+	e.prev.next = e
+	if e.next != nil {
+		e.next.prev = e
+	}
+}
+
+// makeEntries converts the history into a time ordered doubly linked list and
+// returns its sentinel head.
+func makeEntries(history []Operation) *entry {
+	type event struct {
+		time int64
+		e    *entry
+	}
+
+	events := make([]event, 0, 2*len(history))
+	for i, op := range history {
+		ret := &entry{isCall: false, op: i, value: op.Output}
+		call := &entry{isCall: true, op: i, value: op.Input, match: ret}
+		events = append(events, event{time: op.Call, e: call}, event{time: op.Return, e: ret})
+	}
+
+	// When a call and a return share the same time, the call goes first.
+	// This treats the operations as concurrent, which is the safe assumption.
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].e.isCall && !events[j].e.isCall
+	})
+
+	head := &entry{}
+	last := head
+	for _, ev := range events {
+		ev.e.prev = last
+		last.next = ev.e
+		last = ev.e
+	}
+
+	return head
+}
+
+// callFrame is an element of the backtracking stack.
+type callFrame struct {
+	// entry is the linearized call.
+	entry *entry
+	// state is the model state before the call was linearized.
+	state any
+}
+
+// framesToOrder lists the operation indexes of the given frames.
+func framesToOrder(frames []callFrame) []int {
+	order := make([]int, len(frames))
+	for i, frame := range frames {
+		order[i] = frame.entry.op
+	}
+	return order
+}
+
+// cacheEntry is an explored (linearized set, state) pair.
+type cacheEntry struct {
+	linearized bitset
+	state      any
+}
+
+// cacheAdd adds the given pair to the cache. It returns false if the pair was already present.
+func cacheAdd(cache map[uint64][]cacheEntry, model Model, linearized bitset, state any) bool {
+	hash := linearized.hash()
+	for _, ce := range cache[hash] {
+		if ce.linearized.equals(linearized) && model.equal(ce.state, state) {
+			return false
+		}
+	}
+
+	cache[hash] = append(cache[hash], cacheEntry{linearized: linearized, state: state})
+	return true
+}
+
+// bitset is a fixed size set of operation indexes.
+type bitset []uint64
+
+// newBitset creates an empty bitset that can hold the given number of bits.
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+// set the given bit and return the bitset for chaining.
+func (b bitset) set(pos int) bitset {
+	b[pos/64] |= 1 << (uint(pos) % 64)
+	return b
+}
+
+// clear the given bit.
+func (b bitset) clear(pos int) {
+	b[pos/64] &^= 1 << (uint(pos) % 64)
+}
+
+// clone creates a copy of the bitset.
+func (b bitset) clone() bitset {
+	return append(bitset(nil), b...)
+}
+
+// equals reports whether both bitsets hold the same bits.
+func (b bitset) equals(other bitset) bool {
+	for i := range b {
+		if b[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hash of the bitset, using FNV-1a over its words.
+func (b bitset) hash() uint64 {
+	hash := uint64(14695981039346656037)
+	for _, word := range b {
+		hash ^= word
+		hash *= 1099511628211
+	}
+	return hash
+}
@@ -0,0 +1,191 @@
+package linearizability
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// write is a write operation of the given value, called and returned at the given positions.
+func write(value string, call, ret int64) Operation {
+	return Operation{Input: RegisterInput{Write: true, Value: value}, Call: call, Return: ret}
+}
+
+// read is a read operation that returned the given value, called and returned at the given positions.
+func read(value string, call, ret int64) Operation {
+	return Operation{Input: RegisterInput{}, Output: value, Call: call, Return: ret}
+}
+
+// cas is a compare-and-set operation with the given output, called and returned at the given positions.
+func cas(expected, value string, output any, call, ret int64) Operation {
+	return Operation{Input: CompareAndSetInput{Expected: expected, Value: value}, Output: output, Call: call, Return: ret}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   Model
+		history []Operation
+		ok      bool
+	}{
+		{
+			name:    "empty history",
+			model:   RegisterModel,
+			history: nil,
+			ok:      true,
+		},
+		{
+			name:  "sequential writes and reads",
+			model: RegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				read("x", 2, 3),
+				write("y", 4, 5),
+				read("y", 6, 7),
+			},
+			ok: true,
+		},
+		{
+			name:  "concurrent read may see either value",
+			model: RegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				write("y", 2, 5),
+				read("x", 3, 4),
+				read("y", 6, 7),
+			},
+			ok: true,
+		},
+		{
+			name:  "stale read",
+			model: RegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				write("y", 2, 3),
+				read("x", 4, 5),
+			},
+			ok: false,
+		},
+		{
+			name:  "lost write",
+			model: RegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				read("", 2, 3),
+			},
+			ok: false,
+		},
+		{
+			name:  "failed write that took effect",
+			model: RegisterModel,
+			history: []Operation{
+				write("x", 0, math.MaxInt64),
+				read("", 1, 2),
+				read("x", 3, 4),
+			},
+			ok: true,
+		},
+		{
+			name:  "failed write cannot take effect before its call",
+			model: RegisterModel,
+			history: []Operation{
+				read("x", 0, 1),
+				write("x", 2, math.MaxInt64),
+			},
+			ok: false,
+		},
+		{
+			name:  "compare-and-set that swapped",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("x", "y", true, 2, 3),
+				read("y", 4, 5),
+			},
+			ok: true,
+		},
+		{
+			name:  "compare-and-set that swapped on a wrong value",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("z", "y", true, 2, 3),
+			},
+			ok: false,
+		},
+		{
+			name:  "compare-and-set that did not swap on the expected value",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("x", "y", false, 2, 3),
+			},
+			ok: false,
+		},
+		{
+			name:  "compare-and-set with an unknown outcome that swapped",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("x", "y", nil, 2, math.MaxInt64),
+				read("y", 3, 4),
+			},
+			ok: true,
+		},
+		{
+			name:  "compare-and-set with an unknown outcome that did not swap",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("z", "y", nil, 2, math.MaxInt64),
+				read("x", 3, 4),
+			},
+			ok: true,
+		},
+		{
+			name:  "compare-and-set with an unknown outcome cannot swap on a wrong value",
+			model: CASRegisterModel,
+			history: []Operation{
+				write("x", 0, 1),
+				cas("z", "y", nil, 2, math.MaxInt64),
+				read("y", 3, 4),
+			},
+			ok: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Check(test.model, test.history)
+			if result.Ok != test.ok {
+				t.Fatalf("Check() ok = %t, want %t, order: %v", result.Ok, test.ok, result.Order)
+			}
+			if result.Ok && len(result.Order) != len(test.history) {
+				t.Errorf("Check() order = %v, want all %d operations", result.Order, len(test.history))
+			}
+		})
+	}
+}
+
+func TestCheckWithBudget(t *testing.T) {
+	// Concurrent writes, and a read of a value that none of them wrote. Every order
+	// of the writes has to be tried before the history is found broken.
+	var history []Operation
+	for i := 0; i < 10; i++ {
+		history = append(history, write(fmt.Sprint(i), 0, 2))
+	}
+	history = append(history, read("none", 1, 3))
+
+	if result := CheckWithBudget(RegisterModel, history, 100); !result.Unknown || result.Ok {
+		t.Errorf("CheckWithBudget() = %+v, want an unknown result", result)
+	}
+	if result := CheckWithBudget(RegisterModel, history, 0); result.Unknown || result.Ok {
+		t.Errorf("CheckWithBudget() without a limit = %+v, want a broken history", result)
+	}
+
+	// A budget that is not spent does not change the result.
+	history[len(history)-1] = read("3", 1, 3)
+	if result := CheckWithBudget(RegisterModel, history, 10_000); result.Unknown || !result.Ok {
+		t.Errorf("CheckWithBudget() = %+v, want a linearizable history", result)
+	}
+}
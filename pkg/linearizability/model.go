@@ -0,0 +1,113 @@
+package linearizability
+
+// Operation is a single completed (or possibly completed) call in a history.
+//
+// Call and Return are positions of the invocation and the completion of the
+// operation on a common timeline. They only need to be comparable with each
+// other, so they can be timestamps, sequence numbers or anything similar.
+type Operation struct {
+	// Input of the operation, as understood by the Model.
+	Input any
+	// Output of the operation, as understood by the Model.
+	Output any
+	// Call is the position of the invocation of the operation.
+	Call int64
+	// Return is the position of the completion of the operation.
+	//
+	// Operations whose outcome is unknown (for example, a write that timed out)
+	// should use math.MaxInt64, so they are free to take effect at any point
+	// after their invocation, or never.
+	Return int64
+}
+
+// Model is a sequential specification of a data type.
+//
+// The checker uses it to decide whether a sequence of operations is legal.
+type Model struct {
+	// Init provides the initial state of the data type.
+	Init func() any
+	// Step applies an operation to the given state. It reports whether the
+	// operation is legal in that state, and the resulting state.
+	Step func(state, input, output any) (bool, any)
+	// Equal reports whether two states are equal.
+	//
+	// It is optional. When nil, states are compared with the == operator.
+	Equal func(a, b any) bool
+}
+
+// equal compares two states as per the model.
+func (m Model) equal(a, b any) bool {
+	if m.Equal == nil {
+		return a == b
+	}
+	return m.Equal(a, b)
+}
+
+// RegisterInput is the input of an operation on a register.
+type RegisterInput struct {
+	// Write is true for a write operation and false for a read operation.
+	Write bool
+	// Value is the value to write. It is ignored for reads.
+	Value string
+}
+
+// RegisterModel is the model of a single string register with reads and writes.
+//
+// The initial value of the register is the empty string. Reads must have a
+// string output, whereas the output of writes is ignored.
+var RegisterModel = Model{
+	Init: func() any { return "" },
+	Step: func(state, input, output any) (bool, any) {
+		in := input.(RegisterInput)
+		// A write always succeeds and replaces the state.
+		if in.Write {
+			return true, in.Value
+		}
+		// A read is only legal if it returns the current state.
+		return output.(string) == state.(string), state
+	},
+}
+
+// CompareAndSetInput is the input of a compare-and-set operation on a register.
+type CompareAndSetInput struct {
+	// Expected is the value that the register must hold for the write to happen.
+	Expected string
+	// Value is the value to write if the register holds the expected value.
+	Value string
+}
+
+// CASRegisterModel is the model of a single string register with reads, writes
+// and compare-and-set operations.
+//
+// Reads and writes use RegisterInput, like in RegisterModel. Compare-and-set
+// operations use CompareAndSetInput, with a bool output that tells whether the
+// value was written. A nil output means that the outcome is unknown, so the
+// operation is legal either way.
+var CASRegisterModel = Model{
+	Init: RegisterModel.Init,
+	Step: func(state, input, output any) (bool, any) {
+		in, ok := input.(CompareAndSetInput)
+		// Reads and writes behave like in a plain register.
+		if !ok {
+			return RegisterModel.Step(state, input, output)
+		}
+
+		matches := in.Expected == state.(string)
+		// An unknown outcome follows from the state alone.
+		if output == nil {
+			if matches {
+				return true, in.Value
+			}
+			return true, state
+		}
+
+		// The value is written if and only if the register holds the expected value.
+		if output.(bool) != matches {
+			return false, state
+		}
+		if matches {
+			return true, in.Value
+		}
+		return true, state
+	},
+}
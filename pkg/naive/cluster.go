@@ -0,0 +1,25 @@
+package naive
+
+import (
+	"contester/pkg/simulation"
+)
+
+func init() {
+	simulation.Register("naive", NewCluster)
+}
+
+// NewCluster creates a cluster of the naive majority approach with the given number of nodes.
+// Every node runs both an internal and an external API.
+func NewCluster(nodeCount int) []simulation.ExternalAPI {
+	internalAPIs := make([]*Internal, nodeCount)
+	externalAPIs := make([]simulation.ExternalAPI, nodeCount)
+
+	for i := 0; i < nodeCount; i++ {
+		internalAPIs[i] = NewInternal(simulation.NodeID(i))
+	}
+	for i := 0; i < nodeCount; i++ {
+		externalAPIs[i] = NewExternal(simulation.NodeID(i), internalAPIs)
+	}
+
+	return externalAPIs
+}
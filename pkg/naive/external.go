@@ -5,36 +5,51 @@ import (
 	"contester/pkg/utils"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
-// External implements the simulation.ExternalAPI interface using the naive majority approach.
+// External implements the simulation.KeyedExternalAPI and simulation.ListExternalAPI interfaces using the
+// naive majority approach.
 // Read the method descriptions to understand the algorithm.
 //
 // Note that this implementation does NOT guarantee consensus.
 type External struct {
+	// ID of the node that this API runs on.
+	ID           simulation.NodeID
 	InternalAPIs []*Internal
 }
 
-func NewExternal(internalAPIs []*Internal) *External {
-	return &External{InternalAPIs: internalAPIs}
+func NewExternal(id simulation.NodeID, internalAPIs []*Internal) *External {
+	return &External{ID: id, InternalAPIs: internalAPIs}
 }
 
-// Get collects the state from all the internal APIs.
+// stateKey is the key of the single register of the simulation.ExternalAPI interface.
+const stateKey = "state"
+
+// Get implements the simulation.ExternalAPI interface using the GetKey method.
+func (e *External) Get(ctx simulation.Context) (string, error) {
+	return e.GetKey(ctx, stateKey)
+}
+
+// Set implements the simulation.ExternalAPI interface using the SetKey method.
+func (e *External) Set(ctx simulation.Context, state string) error {
+	return e.SetKey(ctx, stateKey, state)
+}
+
+// GetKey collects the state of the given key from all the internal APIs.
 // If a majority of calls fail, the operation is considered failed.
 // Otherwise, if a single value exists on a majority of nodes, it is considered valid state and returned.
 // Otherwise, a consensus error is returned.
-func (e *External) Get(ctx simulation.Context) (string, error) {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan func() (any, error), len(e.InternalAPIs))
-	defer close(respChan)
+func (e *External) GetKey(ctx simulation.Context, key string) (string, error) {
+	// This slice will store the result of the internal API calls, by node.
+	results := make([]func() (any, error), len(e.InternalAPIs))
 
-	// Looping over all internal APIs and getting the state from them all.
-	for _, iAPI := range e.InternalAPIs {
-		go func(iAPI *Internal) {
-			value, err := iAPI.Get(ctx, "state")
-			respChan <- func() (any, error) { return value, err }
-		}(iAPI)
-	}
+	// Calling all internal APIs concurrently and getting the state from them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		value, err := e.InternalAPIs[i].Get(ctx, e.ID, key)
+		results[i] = func() (any, error) { return value, err }
+	})
 
 	// This slice will collect errors.
 	// If they are in majority, the operation will be considered failed
@@ -45,13 +60,18 @@ func (e *External) Get(ctx simulation.Context) (string, error) {
 	valueCounts := map[string]int{}
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		value, err := (<-respChan)()
+	for _, result := range results {
+		value, err := result()
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
 
+		// A node that never received a value holds the empty state.
+		if value == nil {
+			value = ""
+		}
+
 		// Just a type safety check to be sure.
 		valueStr, ok := value.(string)
 		if !ok {
@@ -80,20 +100,17 @@ func (e *External) Get(ctx simulation.Context) (string, error) {
 	return "", fmt.Errorf("no consensus on any value, values: %+v", valueCounts)
 }
 
-// Set sets the state on all the internal APIs.
+// SetKey sets the state of the given key on all the internal APIs.
 // If a majority of calls fail, the operation is considered failed.
 // Otherwise, the operation is considered successful.
-func (e *External) Set(ctx simulation.Context, state string) error {
-	// This channel will store the result of the internal API calls.
-	respChan := make(chan error, len(e.InternalAPIs))
-	defer close(respChan)
+func (e *External) SetKey(ctx simulation.Context, key string, state string) error {
+	// This slice will store the result of the internal API calls, by node.
+	results := make([]error, len(e.InternalAPIs))
 
-	// Looping over all internal APIs and setting the state on them all.
-	for _, iAPI := range e.InternalAPIs {
-		go func(iAPI *Internal) {
-			respChan <- iAPI.Set(ctx, "state", state)
-		}(iAPI)
-	}
+	// Calling all internal APIs concurrently and setting the state on them all.
+	ctx.Concurrently(len(e.InternalAPIs), func(i int) {
+		results[i] = e.InternalAPIs[i].Set(ctx, e.ID, key, state)
+	})
 
 	// This slice will collect errors.
 	// If they are in majority, the operation will be considered failed
@@ -101,8 +118,8 @@ func (e *External) Set(ctx simulation.Context, state string) error {
 	var errs []error
 
 	// Looping again to collect results.
-	for i := 0; i < len(e.InternalAPIs); i++ {
-		if err := <-respChan; err != nil {
+	for _, err := range results {
+		if err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -117,3 +134,70 @@ func (e *External) Set(ctx simulation.Context, state string) error {
 	// The operation was a success.
 	return nil
 }
+
+// Restart implements the simulation.Restartable interface.
+// It wipes the internal API that runs on the same node as this API.
+func (e *External) Restart() {
+	for _, iAPI := range e.InternalAPIs {
+		if iAPI.id == e.ID {
+			iAPI.Restart()
+		}
+	}
+}
+
+// Transact implements the simulation.ListExternalAPI interface using the GetKey and SetKey methods.
+// Every list is stored as a space separated string of its values.
+// The micro-operations run one by one, and an append reads the list before writing it back.
+// So, transactions are not isolated at all, and concurrent appends can overwrite each other.
+func (e *External) Transact(ctx simulation.Context, txn []simulation.ListOp) ([]simulation.ListOp, error) {
+	result := make([]simulation.ListOp, len(txn))
+
+	for i, op := range txn {
+		// Both kinds of micro-operations start with a read of the list.
+		state, err := e.GetKey(ctx, op.Key)
+		if err != nil {
+			return nil, err
+		}
+		list, err := decodeList(state)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Kind == simulation.ListRead {
+			op.List = list
+			result[i] = op
+			continue
+		}
+
+		// Write the list back with the new value.
+		if err := e.SetKey(ctx, op.Key, encodeList(append(list, op.Value))); err != nil {
+			return nil, err
+		}
+		result[i] = op
+	}
+
+	return result, nil
+}
+
+// encodeList encodes a list as a space separated string of its values.
+func encodeList(list []int) string {
+	values := make([]string, len(list))
+	for i, value := range list {
+		values[i] = strconv.Itoa(value)
+	}
+	return strings.Join(values, " ")
+}
+
+// decodeList decodes a list that was encoded by encodeList. The empty state is an empty list.
+func decodeList(state string) ([]int, error) {
+	fields := strings.Fields(state)
+	list := make([]int, len(fields))
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("state %q is not a list: %w", state, err)
+		}
+		list[i] = value
+	}
+	return list, nil
+}
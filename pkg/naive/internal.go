@@ -6,40 +6,50 @@ import (
 )
 
 type Internal struct {
+	// id of the node that this API runs on.
+	id simulation.NodeID
+
 	store      map[string]any
 	storeMutex *sync.RWMutex
 }
 
-func NewInternal() *Internal {
+func NewInternal(id simulation.NodeID) *Internal {
 	return &Internal{
+		id:         id,
 		store:      map[string]any{},
 		storeMutex: &sync.RWMutex{},
 	}
 }
 
-// Set is a simple map set operation. It is thread-safe to use.
-func (i *Internal) Set(ctx simulation.Context, key string, value any) (err error) {
-	// Write lock.
-	i.storeMutex.Lock()
-	defer i.storeMutex.Unlock()
+// Set is a simple map set operation, requested by the given node. It is thread-safe to use.
+func (i *Internal) Set(ctx simulation.Context, from simulation.NodeID, key string, value any) (err error) {
+	_, err = ctx.Deliver(from, i.id, func() (any, error) {
+		// Write lock.
+		i.storeMutex.Lock()
+		defer i.storeMutex.Unlock()
+
+		i.store[key] = value
+		return nil, nil
+	})
+	return err
+}
 
-	if err := ctx.NetworkOp(); err != nil {
-		return err
-	}
+// Get is a simple map get operation, requested by the given node. It is thread-safe to use.
+func (i *Internal) Get(ctx simulation.Context, from simulation.NodeID, key string) (any, error) {
+	return ctx.Deliver(from, i.id, func() (any, error) {
+		// Read lock.
+		i.storeMutex.RLock()
+		defer i.storeMutex.RUnlock()
 
-	i.store[key] = value
-	return nil
+		return i.store[key], nil
+	})
 }
 
-// Get is a simple map get operation. It is thread-safe to use.
-func (i *Internal) Get(ctx simulation.Context, key string) (any, error) {
-	// Read lock.
-	i.storeMutex.RLock()
-	defer i.storeMutex.RUnlock()
-
-	if err := ctx.NetworkOp(); err != nil {
-		return nil, err
-	}
+// Restart drops all the stored values, like a crashed process would. It is thread-safe to use.
+func (i *Internal) Restart() {
+	// Write lock.
+	i.storeMutex.Lock()
+	defer i.storeMutex.Unlock()
 
-	return i.store[key], nil
+	i.store = map[string]any{}
 }
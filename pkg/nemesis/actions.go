@@ -0,0 +1,178 @@
+package nemesis
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Partition splits the network into the given groups of nodes.
+// Nodes can only reach the nodes that share a group with them. Groups may
+// overlap, like the halves of a bridge partition, which share the bridge.
+type Partition struct {
+	Groups [][]simulation.NodeID
+}
+
+func (p Partition) String() string {
+	groups := make([]string, len(p.Groups))
+	for i, group := range p.Groups {
+		ids := make([]string, len(group))
+		for j, node := range group {
+			ids[j] = fmt.Sprint(int(node))
+		}
+		groups[i] = "{" + strings.Join(ids, ",") + "}"
+	}
+	return "partition " + strings.Join(groups, "|")
+}
+
+func (p Partition) validate(nodeCount int) error {
+	if len(p.Groups) == 0 {
+		return fmt.Errorf("partition needs at least one group")
+	}
+
+	for _, group := range p.Groups {
+		for _, node := range group {
+			if err := validateNode(node, nodeCount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p Partition) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.Partition(p.Groups) })
+}
+
+// RandomPartition partitions the network randomly with the given kind.
+type RandomPartition struct {
+	Kind simulation.PartitionKind
+}
+
+func (p RandomPartition) String() string {
+	return "partition " + string(p.Kind)
+}
+
+func (p RandomPartition) validate(int) error {
+	for _, kind := range simulation.PartitionKinds {
+		if p.Kind == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown partition kind: %s", p.Kind)
+}
+
+func (p RandomPartition) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.PartitionRandom(p.Kind) })
+}
+
+// Heal ends any partition of the network.
+type Heal struct{}
+
+func (Heal) String() string {
+	return "heal"
+}
+
+func (Heal) validate(int) error {
+	return nil
+}
+
+func (Heal) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, faults.Heal)
+}
+
+// Crash brings the given node down.
+type Crash struct {
+	Node simulation.NodeID
+}
+
+func (c Crash) String() string {
+	return fmt.Sprintf("crash node %d", c.Node)
+}
+
+func (c Crash) validate(nodeCount int) error {
+	return validateNode(c.Node, nodeCount)
+}
+
+func (c Crash) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.Crash(c.Node) })
+}
+
+// Restart brings the given node back up.
+// With amnesia, the node loses its in-memory state.
+type Restart struct {
+	Node    simulation.NodeID
+	Amnesia bool
+}
+
+func (r Restart) String() string {
+	if r.Amnesia {
+		return fmt.Sprintf("restart node %d with amnesia", r.Node)
+	}
+	return fmt.Sprintf("restart node %d", r.Node)
+}
+
+func (r Restart) validate(nodeCount int) error {
+	return validateNode(r.Node, nodeCount)
+}
+
+func (r Restart) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.Restart(r.Node, r.Amnesia) })
+}
+
+// ClockJump steps the clock of the given node by the given amount,
+// which may be negative.
+type ClockJump struct {
+	Node   simulation.NodeID
+	Amount time.Duration
+}
+
+func (c ClockJump) String() string {
+	return fmt.Sprintf("clock-jump node %d by %s", c.Node, c.Amount)
+}
+
+func (c ClockJump) validate(nodeCount int) error {
+	return validateNode(c.Node, nodeCount)
+}
+
+func (c ClockJump) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.JumpClock(c.Node, c.Amount) })
+}
+
+// LatencySpike delays all network operations by Min to Max, for the given
+// Duration. The network delays of the config apply again afterwards.
+type LatencySpike struct {
+	Min, Max time.Duration
+	Duration time.Duration
+}
+
+func (l LatencySpike) String() string {
+	return fmt.Sprintf("latency %s..%s for %s", l.Min, l.Max, l.Duration)
+}
+
+func (l LatencySpike) validate(int) error {
+	if l.Min < 0 {
+		return fmt.Errorf("latency must be >= 0")
+	}
+	if l.Max < l.Min {
+		return fmt.Errorf("max latency must be >= min latency")
+	}
+	if l.Duration <= 0 {
+		return fmt.Errorf("latency spike duration must be > 0")
+	}
+	return nil
+}
+
+func (l LatencySpike) schedule(faults simulation.Faults, at time.Duration) {
+	faults.At(at, func() { faults.SetLatency(l.Min, l.Max) })
+	faults.At(at+l.Duration, faults.ResetLatency)
+}
+
+// validateNode returns an error if the given node is not part of the simulation.
+func validateNode(node simulation.NodeID, nodeCount int) error {
+	if node < 0 || int(node) >= nodeCount {
+		return fmt.Errorf("node %d does not exist, node count is %d", node, nodeCount)
+	}
+	return nil
+}
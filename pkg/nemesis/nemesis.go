@@ -0,0 +1,101 @@
+// Package nemesis composes timelines of faults for the simulation.
+//
+// A Schedule lists the faults to inject, and when. It can be built in code, or
+// parsed from a small language in which every event reads like:
+//
+//	at 10ms partition {0,1}|{2,3,4}
+//	at 50ms heal
+//	at 60ms crash node 2
+//
+// Events are separated by new lines, semicolons or commas. See Parse for the
+// full syntax.
+package nemesis
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a timeline of faults. It implements the simulation.Nemesis interface.
+type Schedule []Event
+
+// Event is a fault that happens at a given time.
+type Event struct {
+	// At is the simulated time of the event, relative to the start of the simulation.
+	At time.Duration
+	// Action is the fault to inject.
+	Action Action
+}
+
+// Action is a fault that can be injected into a simulation.
+type Action interface {
+	// String formats the action as per the schedule language.
+	String() string
+
+	// validate the action for a simulation with the given number of nodes.
+	validate(nodeCount int) error
+	// schedule the action at the given time, using the given faults.
+	schedule(faults simulation.Faults, at time.Duration)
+}
+
+// Start implements the simulation.Nemesis interface.
+func (s Schedule) Start(faults simulation.Faults) error {
+	// Validate the whole schedule before anything is scheduled.
+	if err := s.Validate(faults.NodeCount()); err != nil {
+		return err
+	}
+
+	for _, event := range s {
+		event.Action.schedule(faults, event.At)
+	}
+	return nil
+}
+
+// Validate the schedule for a simulation with the given number of nodes.
+func (s Schedule) Validate(nodeCount int) error {
+	for _, event := range s {
+		if event.At < 0 {
+			return fmt.Errorf("event %q: time must be >= 0", event)
+		}
+		if event.Action == nil {
+			return fmt.Errorf("event at %s has no action", event.At)
+		}
+		if err := event.Action.validate(nodeCount); err != nil {
+			return fmt.Errorf("event %q: %w", event, err)
+		}
+	}
+	return nil
+}
+
+// String formats the schedule as per the schedule language, so that Parse can read it back.
+func (s Schedule) String() string {
+	events := make([]string, len(s))
+	for i, event := range s {
+		events[i] = event.String()
+	}
+	return strings.Join(events, "; ")
+}
+
+// MarshalText implements the encoding.TextMarshaler interface, so that
+// schedules appear in their readable form in JSON.
+func (s Schedule) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *Schedule) UnmarshalText(text []byte) error {
+	schedule, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = schedule
+	return nil
+}
+
+// String formats the event as per the schedule language.
+func (e Event) String() string {
+	return fmt.Sprintf("at %s %s", e.At, e.Action)
+}
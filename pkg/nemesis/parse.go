@@ -0,0 +1,250 @@
+package nemesis
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse reads a schedule written in the schedule language.
+//
+// Events are separated by new lines, semicolons, or commas outside of braces.
+// Anything after a '#' on a line is a comment. Every event starts with
+// "at <time>", where the time may be prefixed with "t=", followed by one of:
+//
+//	partition {0,1}|{2,3,4}          nodes only reach the nodes of their groups
+//	partition halves                 a random partition of the given kind
+//	heal                             ends the partition
+//	crash node 2                     brings node 2 down
+//	restart node 2 [with amnesia]    brings node 2 back up
+//	clock-jump node 2 by -5ms        steps the clock of node 2
+//	latency 5ms..20ms for 10ms       slows the network down for a while
+//
+// The word "node" is optional. Groups may overlap, like {0,1,2}|{2,3,4}, where
+// node 2 reaches all the others.
+func Parse(text string) (Schedule, error) {
+	var schedule Schedule
+
+	for _, statement := range splitStatements(text) {
+		event, err := parseEvent(statement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event %q: %w", statement, err)
+		}
+		schedule = append(schedule, event)
+	}
+
+	return schedule, nil
+}
+
+// MustParse is like Parse, but panics if the text is invalid.
+// It is meant for schedules that are hardcoded.
+func MustParse(text string) Schedule {
+	schedule, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return schedule
+}
+
+// splitStatements splits the text into the statements of single events,
+// leaving out comments and empty statements.
+func splitStatements(text string) []string {
+	var statements []string
+	var current strings.Builder
+	// Depth of braces, as commas inside braces separate nodes, not events.
+	var depth int
+
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// Drop the comment, if any.
+		if index := strings.IndexByte(line, '#'); index >= 0 {
+			line = line[:index]
+		}
+
+		for _, char := range line {
+			switch {
+			case char == '{':
+				depth++
+			case char == '}':
+				depth--
+			case char == ';', char == ',' && depth <= 0:
+				flush()
+				continue
+			}
+			current.WriteRune(char)
+		}
+		flush()
+	}
+
+	return statements
+}
+
+// parseEvent parses a single event like "at 10ms heal".
+func parseEvent(statement string) (Event, error) {
+	fields := strings.Fields(statement)
+	if len(fields) < 3 || fields[0] != "at" {
+		return Event{}, fmt.Errorf(`expected "at <time> <action>"`)
+	}
+
+	at, err := time.ParseDuration(strings.TrimPrefix(fields[1], "t="))
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid time: %w", err)
+	}
+
+	action, err := parseAction(fields[2], fields[3:])
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{At: at, Action: action}, nil
+}
+
+// parseAction parses the action with the given name and arguments.
+func parseAction(name string, args []string) (Action, error) {
+	switch name {
+	case "partition":
+		// Groups may contain spaces, like "{0, 1} | {2}".
+		layout := strings.Join(args, "")
+		if layout == "" {
+			return nil, fmt.Errorf("partition needs groups or a kind")
+		}
+		if !strings.HasPrefix(layout, "{") {
+			return RandomPartition{Kind: simulation.PartitionKind(layout)}, nil
+		}
+
+		groups, err := parseGroups(layout)
+		if err != nil {
+			return nil, err
+		}
+		return Partition{Groups: groups}, nil
+
+	case "heal":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("heal takes no arguments")
+		}
+		return Heal{}, nil
+
+	case "crash":
+		node, rest, err := parseNode(args)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("unexpected %q", strings.Join(rest, " "))
+		}
+		return Crash{Node: node}, nil
+
+	case "restart":
+		node, rest, err := parseNode(args)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.Join(rest, " ") {
+		case "":
+			return Restart{Node: node}, nil
+		case "amnesia", "with amnesia":
+			return Restart{Node: node, Amnesia: true}, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q", strings.Join(rest, " "))
+		}
+
+	case "clock-jump":
+		node, rest, err := parseNode(args)
+		if err != nil {
+			return nil, err
+		}
+		// The word "by" is optional.
+		if len(rest) > 0 && rest[0] == "by" {
+			rest = rest[1:]
+		}
+		if len(rest) != 1 {
+			return nil, fmt.Errorf("clock-jump needs an amount")
+		}
+
+		amount, err := time.ParseDuration(rest[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount: %w", err)
+		}
+		return ClockJump{Node: node, Amount: amount}, nil
+
+	case "latency":
+		if len(args) != 3 || args[1] != "for" {
+			return nil, fmt.Errorf(`expected "latency <min>..<max> for <duration>"`)
+		}
+
+		// A single value stands for both min and max.
+		minText, maxText, found := strings.Cut(args[0], "..")
+		if !found {
+			maxText = minText
+		}
+
+		var spike LatencySpike
+		var err error
+		if spike.Min, err = time.ParseDuration(minText); err != nil {
+			return nil, fmt.Errorf("invalid min latency: %w", err)
+		}
+		if spike.Max, err = time.ParseDuration(maxText); err != nil {
+			return nil, fmt.Errorf("invalid max latency: %w", err)
+		}
+		if spike.Duration, err = time.ParseDuration(args[2]); err != nil {
+			return nil, fmt.Errorf("invalid duration: %w", err)
+		}
+		return spike, nil
+	}
+
+	return nil, fmt.Errorf("unknown action: %s", name)
+}
+
+// parseNode parses a node ID, optionally preceded by the word "node", from the
+// start of the given arguments. It returns the arguments that follow.
+func parseNode(args []string) (simulation.NodeID, []string, error) {
+	if len(args) > 0 && args[0] == "node" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return 0, nil, fmt.Errorf("missing node")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid node: %s", args[0])
+	}
+	return simulation.NodeID(id), args[1:], nil
+}
+
+// parseGroups parses groups of nodes like "{0,1}|{2,3,4}".
+func parseGroups(layout string) ([][]simulation.NodeID, error) {
+	var groups [][]simulation.NodeID
+
+	for _, group := range strings.Split(layout, "|") {
+		if !strings.HasPrefix(group, "{") || !strings.HasSuffix(group, "}") {
+			return nil, fmt.Errorf("invalid group: %s", group)
+		}
+
+		var nodes []simulation.NodeID
+		for _, id := range strings.Split(strings.Trim(group, "{}"), ",") {
+			// Empty groups are allowed, though useless.
+			if id == "" {
+				continue
+			}
+
+			node, err := strconv.Atoi(id)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node in group %s: %s", group, id)
+			}
+			nodes = append(nodes, simulation.NodeID(node))
+		}
+		groups = append(groups, nodes)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,148 @@
+package nemesis
+
+import (
+	"contester/pkg/simulation"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Schedule
+	}{
+		{
+			name: "empty schedule",
+			text: "  \n# nothing but a comment\n",
+			want: nil,
+		},
+		{
+			name: "one event per line with comments",
+			text: "at 10ms partition {0,1}|{2,3,4} # split\nat t=50ms heal\n",
+			want: Schedule{
+				{At: 10 * time.Millisecond, Action: Partition{Groups: [][]simulation.NodeID{{0, 1}, {2, 3, 4}}}},
+				{At: 50 * time.Millisecond, Action: Heal{}},
+			},
+		},
+		{
+			name: "commas and semicolons outside of braces",
+			text: "at 1ms partition {0, 1} | {2}, at 2ms crash node 2; at 3ms restart 2 with amnesia",
+			want: Schedule{
+				{At: time.Millisecond, Action: Partition{Groups: [][]simulation.NodeID{{0, 1}, {2}}}},
+				{At: 2 * time.Millisecond, Action: Crash{Node: 2}},
+				{At: 3 * time.Millisecond, Action: Restart{Node: 2, Amnesia: true}},
+			},
+		},
+		{
+			name: "random partition, clock jump and latency",
+			text: "at 0s partition halves; at 1ms clock-jump node 1 by -5ms; at 2ms latency 5ms..20ms for 10ms; at 3ms latency 1ms for 1ms",
+			want: Schedule{
+				{At: 0, Action: RandomPartition{Kind: simulation.PartitionHalves}},
+				{At: time.Millisecond, Action: ClockJump{Node: 1, Amount: -5 * time.Millisecond}},
+				{At: 2 * time.Millisecond, Action: LatencySpike{Min: 5 * time.Millisecond, Max: 20 * time.Millisecond, Duration: 10 * time.Millisecond}},
+				{At: 3 * time.Millisecond, Action: LatencySpike{Min: time.Millisecond, Max: time.Millisecond, Duration: time.Millisecond}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.text)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Parse() = %v, want %v", got, test.want)
+			}
+
+			// The formatted schedule reads back the same.
+			again, err := Parse(got.String())
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", got.String(), err)
+			}
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("Parse(%q) = %v, want %v", got.String(), again, got)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// err is a part of the expected error.
+		err string
+	}{
+		{name: "missing at", text: "10ms heal", err: `expected "at <time> <action>"`},
+		{name: "bad time", text: "at soon heal", err: "invalid time"},
+		{name: "time without unit", text: "at 10 heal", err: "invalid time"},
+		{name: "unknown action", text: "at 1ms explode", err: "unknown action"},
+		{name: "heal with arguments", text: "at 1ms heal now", err: "heal takes no arguments"},
+		{name: "partition without groups", text: "at 1ms partition", err: "partition needs groups or a kind"},
+		{name: "unclosed group", text: "at 1ms partition {0,1|{2}", err: "invalid group"},
+		{name: "bad node in group", text: "at 1ms partition {0,x}|{2}", err: "invalid node in group"},
+		{name: "missing node", text: "at 1ms crash node", err: "missing node"},
+		{name: "bad node", text: "at 1ms crash node two", err: "invalid node"},
+		{name: "restart with junk", text: "at 1ms restart 1 with gusto", err: "unexpected"},
+		{name: "clock jump without amount", text: "at 1ms clock-jump 1 by", err: "clock-jump needs an amount"},
+		{name: "bad clock jump amount", text: "at 1ms clock-jump 1 by 5", err: "invalid amount"},
+		{name: "bad latency", text: "at 1ms latency 5ms..x for 1ms", err: "invalid max latency"},
+		{name: "bad latency duration", text: "at 1ms latency 5ms for ever", err: "invalid duration"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.text)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Parse(%q) error = %v, want one with %q", test.text, err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// err is a part of the expected error, or empty if the schedule is valid.
+		err string
+	}{
+		{name: "valid", text: "at 1ms partition {0,1}|{2,3,4}; at 2ms heal; at 3ms crash 4; at 4ms restart 4"},
+		{name: "overlapping groups", text: "at 1ms partition {0,1,2}|{2,3,4}"},
+		{name: "unknown node in group", text: "at 1ms partition {0,1}|{2,5}", err: "node 5 does not exist"},
+		{name: "unknown crashed node", text: "at 1ms crash 7", err: "node 7 does not exist"},
+		{name: "negative node", text: "at 1ms restart -1", err: "node -1 does not exist"},
+		{name: "negative time", text: "at -1ms heal", err: "time must be >= 0"},
+		{name: "unknown partition kind", text: "at 1ms partition thirds", err: "unknown partition kind"},
+		{name: "inverted latency", text: "at 1ms latency 5ms..1ms for 1ms", err: "max latency must be >= min latency"},
+		{name: "empty latency spike", text: "at 1ms latency 5ms for 0s", err: "duration must be > 0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := MustParse(test.text).Validate(5)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Validate() error = %v, want one with %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParse() did not panic on an invalid schedule")
+		}
+	}()
+	MustParse("at 1ms explode")
+}
@@ -0,0 +1,52 @@
+package nemesis
+
+import (
+	"contester/pkg/simulation"
+)
+
+// FromFaults creates a schedule that injects the given recorded faults again,
+// at the same times. Random partitions are replayed with their exact layout.
+//
+// Replaying the faults of a run, with the same seed and the random faults of
+// the config disabled, reproduces the run.
+func FromFaults(faults []simulation.Fault) Schedule {
+	var schedule Schedule
+
+	for i, fault := range faults {
+		var action Action
+
+		switch fault.Kind {
+		case simulation.FaultPartition:
+			action = Partition{Groups: fault.Partition.Groups()}
+		case simulation.FaultHeal:
+			action = Heal{}
+		case simulation.FaultCrash:
+			action = Crash{Node: fault.Nodes[0]}
+		case simulation.FaultRestart:
+			action = Restart{Node: fault.Nodes[0], Amnesia: fault.Amnesia}
+		case simulation.FaultClockJump:
+			action = ClockJump{Node: fault.Nodes[0], Amount: fault.Amount}
+		case simulation.FaultLatency:
+			spike := LatencySpike{Min: fault.MinLatency, Max: fault.MaxLatency}
+			// The spike lasts until the next change of the latency.
+			for _, next := range faults[i+1:] {
+				if next.Kind == simulation.FaultLatency || next.Kind == simulation.FaultLatencyReset {
+					spike.Duration = next.Time - fault.Time
+					break
+				}
+			}
+			// A spike that never ended lasts until the faults end anyway.
+			if spike.Duration <= 0 {
+				spike.Duration = faults[len(faults)-1].Time - fault.Time + 1
+			}
+			action = spike
+		default:
+			// The end of a spike is part of the spike.
+			continue
+		}
+
+		schedule = append(schedule, Event{At: fault.Time, Action: action})
+	}
+
+	return schedule
+}
@@ -0,0 +1,72 @@
+package nemesis
+
+import (
+	"contester/pkg/naive"
+	"contester/pkg/simulation"
+	"reflect"
+	"testing"
+)
+
+func TestFromFaultsReplaysPartitions(t *testing.T) {
+	for _, kind := range simulation.PartitionKinds {
+		t.Run(string(kind), func(t *testing.T) {
+			conf := simulation.QuickStartConfig
+			conf.RequestCount = 50
+			conf.PartitionKinds = []simulation.PartitionKind{kind}
+			conf.CrashDuration = 0
+			conf.MaxClockJump = 0
+			conf.Seed = 42
+
+			recorded, err := simulation.RunWithHistory(conf, naive.NewCluster(5))
+			if recorded == nil {
+				t.Fatalf("RunWithHistory() error = %v", err)
+			}
+			recordedPartitions := partitions(recorded.Faults)
+			if len(recordedPartitions) == 0 {
+				t.Fatalf("no %s partition recorded: %v", kind, recorded.Faults)
+			}
+
+			// Replay the recorded faults instead of the random ones.
+			schedule := FromFaults(recorded.Faults)
+			if err := schedule.Validate(5); err != nil {
+				t.Fatalf("Validate(%s) error = %v", schedule, err)
+			}
+			conf.PartitionKinds = nil
+			conf.Nemesis = schedule
+
+			replayed, err := simulation.RunWithHistory(conf, naive.NewCluster(5))
+			if replayed == nil {
+				t.Fatalf("RunWithHistory() error = %v", err)
+			}
+			if got := partitions(replayed.Faults); !reflect.DeepEqual(got, recordedPartitions) {
+				t.Errorf("replayed partitions = %v, want %v", got, recordedPartitions)
+			}
+			if got, want := outcomes(replayed.Operations), outcomes(recorded.Operations); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed operations = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// partitions provides the views of the partitions among the given faults.
+func partitions(faults []simulation.Fault) [][][]simulation.NodeID {
+	var views [][][]simulation.NodeID
+	for _, fault := range faults {
+		if fault.Kind == simulation.FaultPartition {
+			views = append(views, fault.Partition.Views)
+		}
+	}
+	return views
+}
+
+// outcomes provides the given operations without their indexes. The faults that
+// end with the requests are replayed as events, which may take their turn before
+// a completion at the very same time, and so shift the indexes by one.
+func outcomes(ops []simulation.Operation) []simulation.Operation {
+	stripped := make([]simulation.Operation, len(ops))
+	for i, op := range ops {
+		op.InvokeIndex, op.CompleteIndex = 0, 0
+		stripped[i] = op
+	}
+	return stripped
+}
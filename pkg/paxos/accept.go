@@ -0,0 +1,196 @@
+package paxos
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"errors"
+	"sort"
+)
+
+// acceptRounds is the number of times a leader sends its proposals for a request, before
+// it gives up on getting the command of the request chosen.
+const acceptRounds = 3
+
+// proposal is a command that a leader proposes for a slot.
+type proposal struct {
+	Slot    int
+	Command replicated.Command
+}
+
+// acceptRequest is the message of a leader that asks the acceptors to accept its proposals.
+// A single message carries all proposals that are not chosen yet.
+type acceptRequest struct {
+	Ballot    ballot
+	Proposals []proposal
+	// FirstUnchosen is the first slot that the leader does not know to be chosen. The acceptor
+	// learns that the commands it accepted with the same ballot before it are chosen.
+	FirstUnchosen int
+}
+
+// acceptResponse is the answer to an acceptRequest.
+type acceptResponse struct {
+	// Promised is the newest ballot that the acceptor has seen.
+	Promised ballot
+	Accepted bool
+}
+
+// accept sends the given proposals to the given peer, on behalf of this server.
+func (i *Internal) accept(ctx simulation.Context, peer *Internal, req acceptRequest) (acceptResponse, error) {
+	resp, err := ctx.Deliver(i.id, peer.id, func() (any, error) {
+		return peer.handleAccept(ctx, req), nil
+	})
+	if err != nil {
+		return acceptResponse{}, err
+	}
+
+	return resp.(acceptResponse), nil
+}
+
+// Propose implements the replicated.Node interface. It assigns the next slot to the given
+// command, gets the acceptors to accept it, and provides its result once it is chosen and applied.
+//
+// A command that could not be chosen may still be chosen later, by this leader or by the next one.
+func (i *Internal) Propose(ctx simulation.Context, cmd replicated.Command) (replicated.Result, error) {
+	i.mutex.Lock()
+	if !i.leading {
+		i.mutex.Unlock()
+		return replicated.Result{}, replicated.ErrNotLeader
+	}
+	i.addProposal(i.nextSlot, cmd)
+	i.nextSlot++
+	i.mutex.Unlock()
+
+	var errs []error
+	for round := 0; round < acceptRounds; round++ {
+		errs = i.acceptAll(ctx)
+
+		i.mutex.Lock()
+		res, applied := i.machine.Result(cmd)
+		stillLeader := i.leading
+		i.mutex.Unlock()
+
+		if applied {
+			return res, nil
+		}
+		if !stillLeader {
+			return replicated.Result{}, replicated.ErrNotLeader
+		}
+	}
+
+	return replicated.Result{}, errors.Join(append(errs, errNotChosen)...)
+}
+
+// addProposal makes the leader propose the given command for the given slot. Its own acceptor
+// accepts it right away. The caller must hold the mutex.
+func (i *Internal) addProposal(slot int, cmd replicated.Command) {
+	i.proposals[slot] = cmd
+	i.acceptors[slot] = map[simulation.NodeID]bool{}
+	i.accepted[slot] = accepted{Ballot: i.ballot, Command: cmd}
+	i.recordAccept(slot, i.id)
+}
+
+// recordAccept records that the given node accepted the proposal of the leader for the given
+// slot. Once a majority of the nodes did, the command is chosen. The caller must hold the mutex.
+func (i *Internal) recordAccept(slot int, node simulation.NodeID) {
+	acceptors, pending := i.acceptors[slot]
+	if !pending {
+		return
+	}
+	acceptors[node] = true
+	if len(acceptors) < i.majority() {
+		return
+	}
+
+	cmd := i.proposals[slot]
+	delete(i.proposals, slot)
+	delete(i.acceptors, slot)
+	i.learn(slot, cmd)
+}
+
+// acceptAll sends all proposals of the leader that are not chosen yet to all peers. It returns
+// the errors of the peers that could not be reached.
+func (i *Internal) acceptAll(ctx simulation.Context) []error {
+	i.mutex.Lock()
+	if !i.leading {
+		i.mutex.Unlock()
+		return []error{replicated.ErrNotLeader}
+	}
+	req := acceptRequest{Ballot: i.ballot, FirstUnchosen: i.firstUnchosen}
+	for slot, cmd := range i.proposals {
+		req.Proposals = append(req.Proposals, proposal{Slot: slot, Command: cmd})
+	}
+	i.mutex.Unlock()
+
+	// Map iteration is random, but runs must be replayable.
+	sort.Slice(req.Proposals, func(a, b int) bool { return req.Proposals[a].Slot < req.Proposals[b].Slot })
+
+	// This slice will store the result of the accept requests, by peer.
+	results := make([]func() (acceptResponse, error), len(i.peers))
+
+	// Sending the proposals to all peers concurrently.
+	ctx.Concurrently(len(i.peers), func(n int) {
+		peer := i.peers[n]
+		if peer.id == i.id {
+			return
+		}
+		resp, err := i.accept(ctx, peer, req)
+		results[n] = func() (acceptResponse, error) { return resp, err }
+	})
+
+	var errs []error
+
+	// Looping again to collect results.
+	for n, result := range results {
+		peerID := i.peers[n].id
+		if peerID == i.id {
+			continue
+		}
+		resp, err := result()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		i.mutex.Lock()
+		// A newer ballot means that another leader took over.
+		i.promise(resp.Promised)
+		// The proposals only count for the ballot they were made with.
+		if resp.Accepted && i.leading && i.ballot == req.Ballot {
+			for _, p := range req.Proposals {
+				i.recordAccept(p.Slot, peerID)
+			}
+		}
+		i.mutex.Unlock()
+	}
+
+	return errs
+}
+
+// handleAccept runs on the server when an accept message arrives.
+func (i *Internal) handleAccept(ctx simulation.Context, req acceptRequest) acceptResponse {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if req.Ballot.less(i.promised) {
+		return acceptResponse{Promised: i.promised}
+	}
+
+	// The sender leads the ballot, so a proposer of an older one steps down.
+	i.promise(req.Ballot)
+	i.leader = req.Ballot.Node
+	i.lastContact = ctx.MonotonicOf(i.id)
+
+	for _, p := range req.Proposals {
+		i.accepted[p.Slot] = accepted{Ballot: req.Ballot, Command: p.Command}
+	}
+
+	// A command that the acceptor accepted with the ballot of the leader is the one that the
+	// leader proposed, so it is chosen if the leader knows the slot to be chosen.
+	for slot := i.firstUnchosen; slot < req.FirstUnchosen; slot++ {
+		if acc, exists := i.accepted[slot]; exists && acc.Ballot == req.Ballot {
+			i.learn(slot, acc.Command)
+		}
+	}
+
+	return acceptResponse{Promised: i.promised, Accepted: true}
+}
@@ -0,0 +1,220 @@
+package paxos
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"contester/pkg/utils"
+	"errors"
+	"sync"
+	"time"
+)
+
+func init() {
+	simulation.Register("paxos", NewCluster)
+}
+
+// leaderTimeout is the time for which a node waits to hear from its leader, as per its
+// monotonic clock, before it considers the leader dead.
+const leaderTimeout = 2 * time.Millisecond
+
+var (
+	// errPreempted is returned if a node tried to lead, but a majority of acceptors did not promise its ballot.
+	errPreempted = errors.New("ballot preempted")
+	// errNotChosen is returned if a command could not be chosen. It may still be chosen later.
+	errNotChosen = errors.New("command not chosen")
+)
+
+// ballot numbers the attempts of the nodes to lead. The node breaks the ties between
+// the rounds, so that no two nodes ever use the same ballot.
+type ballot struct {
+	Round int64
+	Node  simulation.NodeID
+}
+
+// less tells whether the ballot is older than the given one.
+func (b ballot) less(other ballot) bool {
+	return b.Round < other.Round || (b.Round == other.Round && b.Node < other.Node)
+}
+
+// accepted is a command that an acceptor accepted for a slot, along with the ballot of the proposal.
+type accepted struct {
+	Ballot  ballot
+	Command replicated.Command
+}
+
+// Internal is a Paxos server. It plays all three roles of Paxos for its node: it is an
+// acceptor of the proposals of the others, a proposer when it leads, and a learner of the
+// chosen commands, which it applies to its state machine.
+//
+// It runs Multi-Paxos. A leader runs the prepare phase once, for all slots that it does
+// not know to be chosen, and then only the accept phase for every new command, as long as
+// no other node prepares a newer ballot.
+//
+// The simulation runs no code on a node between requests, so there are no timers. A
+// server acts when it serves a request instead. A leader proposes the command of every
+// request, a server that heard from its leader recently forwards the request to it, and
+// a server that knows no live leader prepares a ballot of its own first.
+type Internal struct {
+	// id of the node that this server runs on.
+	id simulation.NodeID
+	// peers holds the servers of all nodes, by their IDs, including this one.
+	peers []*Internal
+
+	// Persistent state of the acceptor, which stands for stable storage. It survives restarts.
+
+	// promised is the newest ballot that the acceptor has seen. It rejects older ones.
+	promised ballot
+	// accepted holds the latest command that the acceptor accepted for every slot.
+	accepted map[int]accepted
+
+	// Volatile state, which is lost on restarts.
+
+	// leader is the node that leads the promised ballot, as far as the server knows.
+	leader simulation.NodeID
+	// lastContact is the reading of the monotonic clock of the node when it last heard
+	// from its leader.
+	lastContact time.Duration
+	// chosen holds the commands that the server knows to be chosen, by their slots.
+	chosen map[int]replicated.Command
+	// firstUnchosen is the first slot that the server does not know to be chosen. All
+	// slots before it are applied to the state machine.
+	firstUnchosen int
+	machine       *replicated.Machine
+
+	// Volatile state of a leader.
+
+	// leading is true while the server leads its ballot.
+	leading bool
+	// preparing is true while the server runs the prepare phase of its ballot.
+	preparing bool
+	// ballot is the ballot that the server prepared last.
+	ballot ballot
+	// proposals holds the commands that the leader proposes, by their slots, until they are chosen.
+	proposals map[int]replicated.Command
+	// acceptors holds the nodes that accepted the proposal of the leader, for every slot of proposals.
+	acceptors map[int]map[simulation.NodeID]bool
+	// nextSlot is the slot for the next command of the leader.
+	nextSlot int
+
+	mutex *sync.Mutex
+}
+
+// NewCluster creates a Multi-Paxos cluster with the given number of nodes.
+// Every node runs both a Paxos server and the external API of the replicated state machine.
+func NewCluster(nodeCount int) []simulation.ExternalAPI {
+	internalAPIs := make([]*Internal, nodeCount)
+	cluster := &replicated.Cluster{LeaderTimeout: leaderTimeout, Retry: []error{errPreempted}}
+
+	for i := 0; i < nodeCount; i++ {
+		internalAPIs[i] = NewInternal(simulation.NodeID(i))
+		cluster.Nodes = append(cluster.Nodes, internalAPIs[i])
+	}
+	// Every server knows all servers of the cluster.
+	for i := 0; i < nodeCount; i++ {
+		internalAPIs[i].peers = internalAPIs
+	}
+
+	return cluster.ExternalAPIs()
+}
+
+// NewInternal creates a Paxos server for the given node. Its peers are set by the cluster.
+func NewInternal(id simulation.NodeID) *Internal {
+	i := &Internal{
+		id:       id,
+		accepted: map[int]accepted{},
+		mutex:    &sync.Mutex{},
+	}
+	i.resetVolatileState()
+	return i
+}
+
+// Status implements the replicated.Node interface. A proposer that prepares is electing,
+// and the round of the promised ballot is the epoch.
+func (i *Internal) Status(ctx simulation.Context) replicated.Status {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	status := replicated.Status{
+		Leading:  i.leading,
+		Leader:   replicated.NoNode,
+		Electing: i.preparing,
+		Epoch:    i.promised.Round,
+	}
+	if i.leaderAlive(ctx) {
+		status.Leader = i.leader
+	}
+	return status
+}
+
+// Restart implements the replicated.Node interface. The persistent state of the acceptor
+// stays, and the server learns the chosen commands again once it leads.
+func (i *Internal) Restart() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.resetVolatileState()
+}
+
+// resetVolatileState makes the server a follower that knows nothing but its persistent state.
+func (i *Internal) resetVolatileState() {
+	i.leader = replicated.NoNode
+	i.lastContact = 0
+	i.chosen = map[int]replicated.Command{}
+	i.firstUnchosen = 0
+	i.machine = replicated.NewMachine()
+	i.stepDown()
+}
+
+// stepDown makes the server stop leading, or preparing to. The caller must hold the mutex.
+func (i *Internal) stepDown() {
+	i.leading = false
+	i.preparing = false
+	i.proposals = nil
+	i.acceptors = nil
+}
+
+// promise makes the acceptor promise the given ballot, if it is the newest one it has seen.
+// A leader, or a proposer that prepares, of an older ballot steps down. The caller must hold the mutex.
+func (i *Internal) promise(b ballot) {
+	if !i.promised.less(b) {
+		return
+	}
+	i.promised = b
+	i.leader = replicated.NoNode
+	if i.ballot.less(b) {
+		i.stepDown()
+	}
+}
+
+// leaderAlive tells whether the server leads, or heard from its leader within the
+// leader timeout. The caller must hold the mutex.
+func (i *Internal) leaderAlive(ctx simulation.Context) bool {
+	if i.leading {
+		return true
+	}
+	return i.leader != replicated.NoNode && ctx.MonotonicOf(i.id)-i.lastContact < leaderTimeout
+}
+
+// majority provides the number of nodes that make a majority of the cluster.
+func (i *Internal) majority() int {
+	return utils.GetSmallestMajority(len(i.peers))
+}
+
+// learn records the given command as chosen for the given slot, and applies all chosen
+// commands that follow the applied ones. The caller must hold the mutex.
+func (i *Internal) learn(slot int, cmd replicated.Command) {
+	if slot < i.firstUnchosen {
+		return
+	}
+	i.chosen[slot] = cmd
+
+	for {
+		cmd, ok := i.chosen[i.firstUnchosen]
+		if !ok {
+			return
+		}
+		i.machine.Apply(cmd)
+		delete(i.chosen, i.firstUnchosen)
+		i.firstUnchosen++
+	}
+}
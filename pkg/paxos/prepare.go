@@ -0,0 +1,193 @@
+package paxos
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"errors"
+)
+
+// prepareRequest is the message of a proposer that asks the acceptors to promise its ballot,
+// for all slots from the given one on.
+type prepareRequest struct {
+	Ballot   ballot
+	FromSlot int
+}
+
+// prepareResponse is the answer to a prepareRequest.
+type prepareResponse struct {
+	// Promised is the newest ballot that the acceptor has seen, which is the requested one if it was granted.
+	Promised ballot
+	Granted  bool
+	// Leader is the live leader that the acceptor knows of, if any.
+	Leader simulation.NodeID
+	// Accepted holds the commands that the acceptor accepted, by their slots, from the requested slot on.
+	Accepted map[int]accepted
+}
+
+// prepare asks the given peer to promise the given ballot, on behalf of this server.
+func (i *Internal) prepare(ctx simulation.Context, peer *Internal, req prepareRequest) (prepareResponse, error) {
+	resp, err := ctx.Deliver(i.id, peer.id, func() (any, error) {
+		return peer.handlePrepare(ctx, req), nil
+	})
+	if err != nil {
+		return prepareResponse{}, err
+	}
+
+	return resp.(prepareResponse), nil
+}
+
+// Lead implements the replicated.Node interface. It runs the prepare phase for a new ballot
+// of the server, for all slots that it does not know to be chosen. With the promises of a
+// majority of the acceptors, it becomes the leader, and proposes again every command that
+// the acceptors accepted, so that a command that may have been chosen stays chosen.
+//
+// If it is preempted, it provides the live leader that an acceptor knows of, if any.
+func (i *Internal) Lead(ctx simulation.Context) (simulation.NodeID, error) {
+	i.mutex.Lock()
+	// A single prepare phase runs at a time, as another one would preempt it with a newer ballot.
+	if i.leading || i.preparing {
+		i.mutex.Unlock()
+		return replicated.NoNode, errPreempted
+	}
+	round := i.promised.Round
+	if i.ballot.Round > round {
+		round = i.ballot.Round
+	}
+	i.ballot = ballot{Round: round + 1, Node: i.id}
+	i.preparing = true
+	// The server is an acceptor too, so it promises its own ballot.
+	i.promise(i.ballot)
+	req := prepareRequest{Ballot: i.ballot, FromSlot: i.firstUnchosen}
+	own := i.acceptedFrom(req.FromSlot)
+	i.mutex.Unlock()
+
+	// This slice will store the result of the prepare requests, by peer.
+	results := make([]func() (prepareResponse, error), len(i.peers))
+
+	// Asking all peers concurrently for their promises.
+	ctx.Concurrently(len(i.peers), func(n int) {
+		peer := i.peers[n]
+		if peer.id == i.id {
+			return
+		}
+		resp, err := i.prepare(ctx, peer, req)
+		results[n] = func() (prepareResponse, error) { return resp, err }
+	})
+
+	// The server promised its own ballot.
+	promises := 1
+	var errs []error
+	leaderHint := replicated.NoNode
+	// The command of every slot with the newest ballot that any acceptor accepted it with.
+	newest := own
+
+	// Looping again to collect results.
+	for n, result := range results {
+		if i.peers[n].id == i.id {
+			continue
+		}
+		resp, err := result()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		i.mutex.Lock()
+		// A newer ballot preempts this one.
+		i.promise(resp.Promised)
+		i.mutex.Unlock()
+
+		if resp.Leader != replicated.NoNode {
+			leaderHint = resp.Leader
+		}
+		if !resp.Granted {
+			continue
+		}
+		promises++
+		for slot, acc := range resp.Accepted {
+			if current, exists := newest[slot]; !exists || current.Ballot.less(acc.Ballot) {
+				newest[slot] = acc
+			}
+		}
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// The server may have been preempted meanwhile, or restarted.
+	if !i.preparing || i.promised != req.Ballot {
+		return leaderHint, errPreempted
+	}
+	i.preparing = false
+	if promises < i.majority() {
+		return leaderHint, errors.Join(append(errs, errPreempted)...)
+	}
+
+	i.becomeLeader(newest)
+	return replicated.NoNode, nil
+}
+
+// becomeLeader makes the server the leader of its ballot. It proposes the given commands
+// again, and a no-op for every slot in between them that no acceptor accepted a command
+// for. The caller must hold the mutex.
+func (i *Internal) becomeLeader(newest map[int]accepted) {
+	i.leading = true
+	i.leader = i.id
+	i.proposals = map[int]replicated.Command{}
+	i.acceptors = map[int]map[simulation.NodeID]bool{}
+
+	i.nextSlot = i.firstUnchosen
+	for slot := range newest {
+		if slot >= i.nextSlot {
+			i.nextSlot = slot + 1
+		}
+	}
+
+	for slot := i.firstUnchosen; slot < i.nextSlot; slot++ {
+		cmd := replicated.Command{Kind: replicated.CommandNoop}
+		if acc, exists := newest[slot]; exists {
+			cmd = acc.Command
+		}
+		// A command that the server knows to be chosen is the only one that can be.
+		if chosen, exists := i.chosen[slot]; exists {
+			cmd = chosen
+		}
+		i.addProposal(slot, cmd)
+	}
+}
+
+// acceptedFrom provides a copy of the commands that the acceptor accepted, from the given
+// slot on. The caller must hold the mutex.
+func (i *Internal) acceptedFrom(fromSlot int) map[int]accepted {
+	result := map[int]accepted{}
+	for slot, acc := range i.accepted {
+		if slot >= fromSlot {
+			result[slot] = acc
+		}
+	}
+	return result
+}
+
+// handlePrepare runs on the server when a prepare message arrives.
+func (i *Internal) handlePrepare(ctx simulation.Context, req prepareRequest) prepareResponse {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	resp := prepareResponse{Leader: replicated.NoNode}
+	if i.leaderAlive(ctx) {
+		resp.Leader = i.leader
+	}
+
+	// An acceptor that hears from a live leader ignores other proposers, so that a node
+	// that lost touch with the leader cannot disrupt the cluster.
+	if req.Ballot.less(i.promised) || (req.Ballot != i.promised && resp.Leader != replicated.NoNode && resp.Leader != req.Ballot.Node) {
+		resp.Promised = i.promised
+		return resp
+	}
+
+	i.promise(req.Ballot)
+	resp.Promised = i.promised
+	resp.Granted = true
+	resp.Accepted = i.acceptedFrom(req.FromSlot)
+	return resp
+}
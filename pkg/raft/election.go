@@ -0,0 +1,193 @@
+package raft
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"errors"
+)
+
+// requestVoteRequest is the message of a candidate that asks for a vote.
+type requestVoteRequest struct {
+	Term      int64
+	Candidate simulation.NodeID
+	// LastLogIndex and LastLogTerm describe the log of the candidate, so that only a
+	// candidate with all committed entries can win.
+	LastLogIndex int
+	LastLogTerm  int64
+}
+
+// requestVoteResponse is the answer to a requestVoteRequest.
+type requestVoteResponse struct {
+	Term    int64
+	Granted bool
+	// Voter is the node that answered.
+	Voter simulation.NodeID
+	// Leader is the live leader that the voter knows of, if any.
+	Leader simulation.NodeID
+	// LastLogIndex and LastLogTerm describe the log of the voter, so that a candidate
+	// that lost for its log can tell which node may win instead.
+	LastLogIndex int
+	LastLogTerm  int64
+}
+
+// requestVote asks the given peer for its vote, on behalf of this server.
+func (i *Internal) requestVote(ctx simulation.Context, peer *Internal, req requestVoteRequest) (requestVoteResponse, error) {
+	resp, err := ctx.Deliver(i.id, peer.id, func() (any, error) {
+		return peer.handleRequestVote(ctx, req), nil
+	})
+	if err != nil {
+		return requestVoteResponse{}, err
+	}
+
+	return resp.(requestVoteResponse), nil
+}
+
+// campaign makes the server a candidate of a new term, and asks all peers for their votes.
+// With the votes of a majority, it becomes the leader, and appends a no-op entry of its term,
+// so that it can commit the entries of the earlier terms.
+//
+// If it loses, it provides the node that is more likely to lead, if any. That is the live
+// leader that a voter knows of, or else the voter with the most up to date log, if it is
+// more up to date than the one of the candidate.
+func (i *Internal) campaign(ctx simulation.Context) (simulation.NodeID, error) {
+	i.mutex.Lock()
+	// A single campaign runs at a time, as another one would end it with a newer term.
+	if i.role != follower {
+		i.mutex.Unlock()
+		return replicated.NoNode, errElectionLost
+	}
+	i.currentTerm++
+	i.role = candidate
+	i.votedFor = i.id
+	i.leader = replicated.NoNode
+	req := requestVoteRequest{
+		Term:         i.currentTerm,
+		Candidate:    i.id,
+		LastLogIndex: i.lastIndex(),
+		LastLogTerm:  i.log[i.lastIndex()].Term,
+	}
+	i.mutex.Unlock()
+
+	// This slice will store the result of the vote requests, by peer.
+	results := make([]func() (requestVoteResponse, error), len(i.peers))
+
+	// Asking all peers concurrently for their votes.
+	ctx.Concurrently(len(i.peers), func(n int) {
+		peer := i.peers[n]
+		if peer.id == i.id {
+			return
+		}
+		resp, err := i.requestVote(ctx, peer, req)
+		results[n] = func() (requestVoteResponse, error) { return resp, err }
+	})
+
+	// The candidate votes for itself.
+	votes := 1
+	var errs []error
+	// The nodes that are more likely to lead.
+	leaderHint, bestVoter := replicated.NoNode, replicated.NoNode
+	bestIndex, bestTerm := req.LastLogIndex, req.LastLogTerm
+
+	// Looping again to collect results.
+	for n, result := range results {
+		if i.peers[n].id == i.id {
+			continue
+		}
+		resp, err := result()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		i.mutex.Lock()
+		// A newer term ends the candidacy.
+		if resp.Term > i.currentTerm {
+			i.becomeFollower(resp.Term)
+		}
+		i.mutex.Unlock()
+
+		if resp.Granted {
+			votes++
+		}
+		if resp.Leader != replicated.NoNode {
+			leaderHint = resp.Leader
+		}
+		if resp.LastLogTerm > bestTerm || (resp.LastLogTerm == bestTerm && resp.LastLogIndex > bestIndex) {
+			bestVoter, bestIndex, bestTerm = resp.Voter, resp.LastLogIndex, resp.LastLogTerm
+		}
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	hint := bestVoter
+	if leaderHint != replicated.NoNode {
+		hint = leaderHint
+	}
+
+	// The server may have stepped down meanwhile, for a newer term or another leader.
+	if i.role != candidate || i.currentTerm != req.Term {
+		return hint, errElectionLost
+	}
+	if votes < i.majority() {
+		// The server has voted in this term, so it waits for the next request to campaign again.
+		i.role = follower
+		return hint, errors.Join(append(errs, errElectionLost)...)
+	}
+
+	i.becomeLeader()
+	return replicated.NoNode, nil
+}
+
+// becomeLeader makes the candidate the leader of its term. The caller must hold the mutex.
+func (i *Internal) becomeLeader() {
+	i.role = leader
+	i.leader = i.id
+
+	// Every follower is assumed to be up to date, until it tells otherwise.
+	i.nextIndex = make([]int, len(i.peers))
+	i.matchIndex = make([]int, len(i.peers))
+	for n := range i.peers {
+		i.nextIndex[n] = i.lastIndex() + 1
+	}
+
+	i.log = append(i.log, entry{Term: i.currentTerm, Command: replicated.Command{Kind: replicated.CommandNoop}})
+	i.matchIndex[i.id] = i.lastIndex()
+}
+
+// handleRequestVote runs on the server when a requestVote message arrives.
+func (i *Internal) handleRequestVote(ctx simulation.Context, req requestVoteRequest) requestVoteResponse {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	lastTerm := i.log[i.lastIndex()].Term
+	resp := requestVoteResponse{Voter: i.id, Leader: replicated.NoNode, LastLogIndex: i.lastIndex(), LastLogTerm: lastTerm}
+	if i.leaderAlive(ctx) {
+		resp.Leader = i.leader
+	}
+
+	if req.Term < i.currentTerm {
+		resp.Term = i.currentTerm
+		return resp
+	}
+
+	if req.Term > i.currentTerm {
+		// A server that hears from a live leader ignores candidates, so that a node that
+		// lost touch with the leader cannot disrupt the cluster.
+		if resp.Leader != replicated.NoNode && resp.Leader != req.Candidate {
+			resp.Term = i.currentTerm
+			return resp
+		}
+		i.becomeFollower(req.Term)
+	}
+	resp.Term = i.currentTerm
+
+	// The vote goes to the first candidate of the term whose log is at least as up to date as this one.
+	upToDate := req.LastLogTerm > lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex >= i.lastIndex())
+	if (i.votedFor == replicated.NoNode || i.votedFor == req.Candidate) && upToDate {
+		i.votedFor = req.Candidate
+		resp.Granted = true
+	}
+
+	return resp
+}
@@ -0,0 +1,198 @@
+package raft
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"contester/pkg/utils"
+	"errors"
+	"sync"
+	"time"
+)
+
+func init() {
+	simulation.Register("raft", NewCluster)
+}
+
+// electionTimeout is the time for which a node waits to hear from its leader, as per its
+// monotonic clock, before it considers the leader dead.
+const electionTimeout = 2 * time.Millisecond
+
+var (
+	// errElectionLost is returned if a node campaigned, but did not get a majority of votes.
+	errElectionLost = errors.New("election lost")
+	// errNotCommitted is returned if an entry could not be committed. It may still be committed later.
+	errNotCommitted = errors.New("entry not committed")
+)
+
+// role of a node in its current term.
+type role string
+
+const (
+	follower  role = "follower"
+	candidate role = "candidate"
+	leader    role = "leader"
+)
+
+// entry is an entry of the log.
+type entry struct {
+	// Term in which a leader appended the entry.
+	Term    int64
+	Command replicated.Command
+}
+
+// Internal is a Raft server. It holds the log and the state machine of its node, and
+// it handles the messages of the other servers.
+//
+// The simulation runs no code on a node between requests, so there are no timers. A
+// server acts when it serves a request instead. A leader replicates its log with every
+// request, a follower that heard from its leader recently forwards the request to it,
+// and a server that knows no live leader campaigns to become one first.
+type Internal struct {
+	// id of the node that this server runs on.
+	id simulation.NodeID
+	// peers holds the servers of all nodes, by their IDs, including this one.
+	peers []*Internal
+
+	// Persistent state, which stands for stable storage. It survives restarts.
+
+	// currentTerm is the latest term that the server has seen.
+	currentTerm int64
+	// votedFor is the candidate that the server voted for in the current term, if any.
+	votedFor simulation.NodeID
+	// log holds the entries, with a sentinel entry of term 0 at index 0.
+	log []entry
+
+	// Volatile state, which is lost on restarts.
+
+	role role
+	// leader is the leader of the current term, as far as the server knows.
+	leader simulation.NodeID
+	// lastContact is the reading of the monotonic clock of the node when it last heard
+	// from its leader, or granted a vote.
+	lastContact time.Duration
+	// commitIndex is the index of the latest entry known to be committed.
+	commitIndex int
+	// lastApplied is the index of the latest entry applied to the state machine.
+	lastApplied int
+	machine     *replicated.Machine
+
+	// Volatile state of a leader.
+
+	// nextIndex is the index of the next entry to send to every node.
+	nextIndex []int
+	// matchIndex is the index of the latest entry known to be replicated on every node.
+	matchIndex []int
+
+	mutex *sync.Mutex
+}
+
+// NewCluster creates a Raft cluster with the given number of nodes.
+// Every node runs both a Raft server and the external API of the replicated state machine.
+func NewCluster(nodeCount int) []simulation.ExternalAPI {
+	internalAPIs := make([]*Internal, nodeCount)
+	cluster := &replicated.Cluster{LeaderTimeout: electionTimeout, Retry: []error{errElectionLost}}
+
+	for i := 0; i < nodeCount; i++ {
+		internalAPIs[i] = NewInternal(simulation.NodeID(i))
+		cluster.Nodes = append(cluster.Nodes, internalAPIs[i])
+	}
+	// Every server knows all servers of the cluster.
+	for i := 0; i < nodeCount; i++ {
+		internalAPIs[i].peers = internalAPIs
+	}
+
+	return cluster.ExternalAPIs()
+}
+
+// NewInternal creates a Raft server for the given node. Its peers are set by the cluster.
+func NewInternal(id simulation.NodeID) *Internal {
+	i := &Internal{
+		id:       id,
+		votedFor: replicated.NoNode,
+		log:      []entry{{Term: 0}},
+		mutex:    &sync.Mutex{},
+	}
+	i.resetVolatileState()
+	return i
+}
+
+// Status implements the replicated.Node interface. A candidate is electing, and the
+// term is the epoch.
+func (i *Internal) Status(ctx simulation.Context) replicated.Status {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	status := replicated.Status{
+		Leading:  i.role == leader,
+		Leader:   replicated.NoNode,
+		Electing: i.role == candidate,
+		Epoch:    i.currentTerm,
+	}
+	if i.leaderAlive(ctx) {
+		status.Leader = i.leader
+	}
+	return status
+}
+
+// Lead implements the replicated.Node interface by campaigning.
+func (i *Internal) Lead(ctx simulation.Context) (simulation.NodeID, error) {
+	return i.campaign(ctx)
+}
+
+// Restart implements the replicated.Node interface. The persistent state stays, and
+// the state machine catches up once the server learns which entries are committed.
+func (i *Internal) Restart() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.resetVolatileState()
+}
+
+// resetVolatileState makes the server a follower that knows nothing but its persistent state.
+func (i *Internal) resetVolatileState() {
+	i.role = follower
+	i.leader = replicated.NoNode
+	i.lastContact = 0
+	i.commitIndex = 0
+	i.lastApplied = 0
+	i.machine = replicated.NewMachine()
+	i.nextIndex = nil
+	i.matchIndex = nil
+}
+
+// becomeFollower makes the server a follower of the given term. The caller must hold the mutex.
+func (i *Internal) becomeFollower(term int64) {
+	if term > i.currentTerm {
+		i.currentTerm = term
+		i.votedFor = replicated.NoNode
+		i.leader = replicated.NoNode
+	}
+	i.role = follower
+}
+
+// leaderAlive tells whether the server leads, or heard from its leader within the
+// election timeout. The caller must hold the mutex.
+func (i *Internal) leaderAlive(ctx simulation.Context) bool {
+	if i.role == leader {
+		return true
+	}
+	return i.leader != replicated.NoNode && ctx.MonotonicOf(i.id)-i.lastContact < electionTimeout
+}
+
+// lastIndex provides the index of the last entry of the log. The caller must hold the mutex.
+func (i *Internal) lastIndex() int {
+	return len(i.log) - 1
+}
+
+// majority provides the number of nodes that make a majority of the cluster.
+func (i *Internal) majority() int {
+	return utils.GetSmallestMajority(len(i.peers))
+}
+
+// applyCommitted applies the committed entries that are not applied yet. The caller must hold the mutex.
+func (i *Internal) applyCommitted() {
+	for i.lastApplied < i.commitIndex {
+		i.lastApplied++
+		i.machine.Apply(i.log[i.lastApplied].Command)
+	}
+}
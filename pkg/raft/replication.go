@@ -0,0 +1,246 @@
+package raft
+
+import (
+	"contester/pkg/replicated"
+	"contester/pkg/simulation"
+	"errors"
+)
+
+// replicationRounds is the number of times a leader replicates its log for a request,
+// before it gives up on committing the entry of the request.
+const replicationRounds = 3
+
+// appendEntriesRequest is the message of a leader that replicates its log.
+type appendEntriesRequest struct {
+	Term   int64
+	Leader simulation.NodeID
+	// PrevLogIndex and PrevLogTerm describe the entry that precedes the given entries,
+	// which the log of the follower must hold for the entries to be appended.
+	PrevLogIndex int
+	PrevLogTerm  int64
+	Entries      []entry
+	LeaderCommit int
+}
+
+// appendEntriesResponse is the answer to an appendEntriesRequest.
+type appendEntriesResponse struct {
+	Term    int64
+	Success bool
+	// MatchIndex is the index of the last entry that the follower holds as per the request, on success.
+	MatchIndex int
+	// ConflictIndex is the index from which the leader should retry, on failure.
+	ConflictIndex int
+}
+
+// appendEntries sends the given entries to the given peer, on behalf of this server.
+func (i *Internal) appendEntries(ctx simulation.Context, peer *Internal, req appendEntriesRequest) (appendEntriesResponse, error) {
+	resp, err := ctx.Deliver(i.id, peer.id, func() (any, error) {
+		return peer.handleAppendEntries(ctx, req), nil
+	})
+	if err != nil {
+		return appendEntriesResponse{}, err
+	}
+
+	return resp.(appendEntriesResponse), nil
+}
+
+// Propose implements the replicated.Node interface. It appends the given command to the
+// log of the leader, replicates it, and provides its result once it is committed and applied.
+//
+// A command that could not be committed may still be committed later, by this leader or
+// by the next one.
+func (i *Internal) Propose(ctx simulation.Context, cmd replicated.Command) (replicated.Result, error) {
+	i.mutex.Lock()
+	if i.role != leader {
+		i.mutex.Unlock()
+		return replicated.Result{}, replicated.ErrNotLeader
+	}
+	i.log = append(i.log, entry{Term: i.currentTerm, Command: cmd})
+	i.matchIndex[i.id] = i.lastIndex()
+	i.mutex.Unlock()
+
+	var errs []error
+	for round := 0; round < replicationRounds; round++ {
+		errs = i.replicate(ctx)
+
+		i.mutex.Lock()
+		res, applied := i.machine.Result(cmd)
+		stillLeader := i.role == leader
+		i.mutex.Unlock()
+
+		if applied {
+			return res, nil
+		}
+		if !stillLeader {
+			return replicated.Result{}, replicated.ErrNotLeader
+		}
+	}
+
+	return replicated.Result{}, errors.Join(append(errs, errNotCommitted)...)
+}
+
+// replicate sends the log of the leader to all peers, and commits the entries that
+// a majority of the nodes hold. It returns the errors of the peers that could not be reached.
+func (i *Internal) replicate(ctx simulation.Context) []error {
+	// This slice will store the result of the replication to every peer, by peer.
+	results := make([]error, len(i.peers))
+
+	// Replicating to all peers concurrently.
+	ctx.Concurrently(len(i.peers), func(n int) {
+		if peer := i.peers[n]; peer.id != i.id {
+			results[n] = i.replicateTo(ctx, peer)
+		}
+	})
+
+	var errs []error
+
+	// Looping again to collect results.
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.advanceCommitIndex()
+	i.applyCommitted()
+	return errs
+}
+
+// replicateTo brings the log of the given peer up to date with the log of the leader.
+// On a mismatch, it steps back through the log until it finds the entry that both hold.
+func (i *Internal) replicateTo(ctx simulation.Context, peer *Internal) error {
+	for {
+		i.mutex.Lock()
+		if i.role != leader {
+			i.mutex.Unlock()
+			return replicated.ErrNotLeader
+		}
+		next := i.nextIndex[peer.id]
+		req := appendEntriesRequest{
+			Term:         i.currentTerm,
+			Leader:       i.id,
+			PrevLogIndex: next - 1,
+			PrevLogTerm:  i.log[next-1].Term,
+			// The peer gets its own copy, as the log of the leader keeps growing.
+			Entries:      append([]entry{}, i.log[next:]...),
+			LeaderCommit: i.commitIndex,
+		}
+		i.mutex.Unlock()
+
+		resp, err := i.appendEntries(ctx, peer, req)
+		if err != nil {
+			return err
+		}
+
+		i.mutex.Lock()
+		// A newer term means that another leader took over.
+		if resp.Term > i.currentTerm {
+			i.becomeFollower(resp.Term)
+		}
+		if i.role != leader || i.currentTerm != req.Term {
+			i.mutex.Unlock()
+			return replicated.ErrNotLeader
+		}
+
+		if resp.Success {
+			// Responses may arrive out of order, so the indexes only ever grow.
+			i.matchIndex[peer.id] = maxInt(i.matchIndex[peer.id], resp.MatchIndex)
+			i.nextIndex[peer.id] = maxInt(i.nextIndex[peer.id], resp.MatchIndex+1)
+			i.mutex.Unlock()
+			return nil
+		}
+
+		// Retry from the entry that the peer pointed at, which always moves back.
+		i.nextIndex[peer.id] = maxInt(1, minInt(i.nextIndex[peer.id]-1, resp.ConflictIndex))
+		i.mutex.Unlock()
+	}
+}
+
+// advanceCommitIndex commits the latest entry of the current term that a majority of the
+// nodes hold, along with all entries before it. Entries of earlier terms are never committed
+// by counting, as a future leader might still overwrite them. The caller must hold the mutex.
+func (i *Internal) advanceCommitIndex() {
+	if i.role != leader {
+		return
+	}
+
+	for index := i.lastIndex(); index > i.commitIndex; index-- {
+		if i.log[index].Term != i.currentTerm {
+			return
+		}
+
+		holders := 0
+		for _, match := range i.matchIndex {
+			if match >= index {
+				holders++
+			}
+		}
+		if holders >= i.majority() {
+			i.commitIndex = index
+			return
+		}
+	}
+}
+
+// handleAppendEntries runs on the server when an appendEntries message arrives.
+func (i *Internal) handleAppendEntries(ctx simulation.Context, req appendEntriesRequest) appendEntriesResponse {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if req.Term < i.currentTerm {
+		return appendEntriesResponse{Term: i.currentTerm}
+	}
+
+	// The sender leads the term, so a candidate of the same term steps down too.
+	i.becomeFollower(req.Term)
+	i.leader = req.Leader
+	i.lastContact = ctx.MonotonicOf(i.id)
+
+	// The log must hold the entry that precedes the new ones.
+	if req.PrevLogIndex > i.lastIndex() {
+		return appendEntriesResponse{Term: i.currentTerm, ConflictIndex: i.lastIndex() + 1}
+	}
+	if i.log[req.PrevLogIndex].Term != req.PrevLogTerm {
+		return appendEntriesResponse{Term: i.currentTerm, ConflictIndex: req.PrevLogIndex}
+	}
+
+	// Append the new entries. An existing entry is only dropped if it conflicts with a
+	// new one, along with all that follow it, as the request may be a stale one.
+	for n, e := range req.Entries {
+		index := req.PrevLogIndex + 1 + n
+		if index <= i.lastIndex() {
+			if i.log[index].Term == e.Term {
+				continue
+			}
+			i.log = i.log[:index]
+		}
+		i.log = append(i.log, e)
+	}
+
+	// The entries up to the last new one are known to match the log of the leader. A stale
+	// request may know of fewer of them, so the commit index only ever grows.
+	matchIndex := req.PrevLogIndex + len(req.Entries)
+	if commitIndex := minInt(req.LeaderCommit, matchIndex); commitIndex > i.commitIndex {
+		i.commitIndex = commitIndex
+		i.applyCommitted()
+	}
+
+	return appendEntriesResponse{Term: i.currentTerm, Success: true, MatchIndex: matchIndex}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+// Package replicated holds what the consensus algorithms with a replicated state
+// machine share: the state machine itself, which applies every command once, the
+// external API, which turns every call into a command, and the loop that gets a
+// command to the leader of the cluster.
+//
+// An algorithm only implements the Node interface, which orders the commands and
+// elects the leader, like Raft or Multi-Paxos do.
+package replicated
+
+import (
+	"contester/pkg/simulation"
+	"errors"
+	"time"
+)
+
+// NoNode stands for an unknown node, like an unknown leader.
+const NoNode simulation.NodeID = -1
+
+var (
+	// ErrNotLeader is returned if a node is asked to propose a command, but it does not lead.
+	ErrNotLeader = errors.New("not the leader")
+	// ErrNoLeader is returned if a node waited for the leader timeout, but neither found
+	// a leader nor could try to lead.
+	ErrNoLeader = errors.New("no leader found")
+)
+
+// Status tells what a node knows about the leader of its cluster.
+type Status struct {
+	// Leading is true if the node is the leader.
+	Leading bool
+	// Leader is the leader that the node heard from within the leader timeout, or NoNode.
+	Leader simulation.NodeID
+	// Electing is true while the node tries to become the leader, for another request.
+	Electing bool
+	// Epoch is the number of the latest attempt to lead that the node has seen, like the
+	// term of Raft or the round of a Paxos ballot.
+	Epoch int64
+}
+
+// Node is a server of a consensus algorithm that runs a replicated state machine.
+type Node interface {
+	// Status provides what the node knows about the leader.
+	Status(ctx simulation.Context) Status
+	// Propose gets the given command ordered and applied, while the node leads, and
+	// provides its result. It returns ErrNotLeader if the node does not lead, or stops leading.
+	Propose(ctx simulation.Context, cmd Command) (Result, error)
+	// Lead tries to make the node the leader. If it fails, it provides the node that is more
+	// likely to lead, if it knows one, or else NoNode.
+	Lead(ctx simulation.Context) (simulation.NodeID, error)
+	// Restart drops the volatile state of the node, like a crashed process would.
+	Restart()
+}
+
+// Cluster holds the nodes of a replicated state machine, and gets the commands of the
+// external APIs to its leader. See the execute method for how it does so.
+type Cluster struct {
+	// Nodes holds the nodes by their IDs.
+	Nodes []Node
+	// LeaderTimeout is the time for which a node waits to hear from its leader, as per
+	// its monotonic clock, before it considers the leader dead. It is also the longest
+	// time for which a request waits before it tries to lead.
+	LeaderTimeout time.Duration
+	// Retry holds the errors of Lead after which a request tries again, like a lost
+	// election, besides ErrNotLeader and ErrNoLeader.
+	Retry []error
+}
+
+// ExternalAPIs provides an external API for every node of the cluster.
+func (c *Cluster) ExternalAPIs() []simulation.ExternalAPI {
+	externalAPIs := make([]simulation.ExternalAPI, len(c.Nodes))
+	for i := range c.Nodes {
+		externalAPIs[i] = NewExternal(simulation.NodeID(i), c)
+	}
+	return externalAPIs
+}
@@ -0,0 +1,115 @@
+package replicated
+
+import (
+	"contester/pkg/simulation"
+	"sync"
+)
+
+// External implements the simulation.CASExternalAPI, simulation.KeyedExternalAPI and
+// simulation.ListExternalAPI interfaces on top of a replicated state machine.
+// Every call is a command of the state machine, reads included, so it takes effect once
+// the protocol of the cluster orders it.
+type External struct {
+	// ID of the node that this API runs on.
+	ID      simulation.NodeID
+	Cluster *Cluster
+
+	// idle holds the client sessions that no call uses at the moment. A call takes one,
+	// or opens a new one, so there are only as many sessions as concurrent calls.
+	idle      []*session
+	idleMutex *sync.Mutex
+}
+
+// session is a client session of the state machine, which runs one command at a time.
+type session struct {
+	id string
+	// seq is the sequence number of the last command of the session.
+	seq uint64
+}
+
+func NewExternal(id simulation.NodeID, cluster *Cluster) *External {
+	return &External{ID: id, Cluster: cluster, idleMutex: &sync.Mutex{}}
+}
+
+// stateKey is the key of the single register of the simulation.ExternalAPI interface.
+const stateKey = "state"
+
+// Get implements the simulation.ExternalAPI interface using the GetKey method.
+func (e *External) Get(ctx simulation.Context) (string, error) {
+	return e.GetKey(ctx, stateKey)
+}
+
+// Set implements the simulation.ExternalAPI interface using the SetKey method.
+func (e *External) Set(ctx simulation.Context, state string) error {
+	return e.SetKey(ctx, stateKey, state)
+}
+
+// CompareAndSet implements the simulation.CASExternalAPI interface using the CompareAndSetKey method.
+func (e *External) CompareAndSet(ctx simulation.Context, expected string, state string) (bool, error) {
+	return e.CompareAndSetKey(ctx, stateKey, expected, state)
+}
+
+// GetKey provides the value of the given key, as of the point at which its command is ordered.
+func (e *External) GetKey(ctx simulation.Context, key string) (string, error) {
+	res, err := e.execute(ctx, Command{Kind: CommandGet, Key: key})
+	return res.Value, err
+}
+
+// SetKey sets the value of the given key.
+func (e *External) SetKey(ctx simulation.Context, key string, state string) error {
+	_, err := e.execute(ctx, Command{Kind: CommandSet, Key: key, Value: state})
+	return err
+}
+
+// CompareAndSetKey sets the value of the given key only if its current value is the expected one.
+// The state machine checks the condition when it applies the command, so no lock is needed.
+func (e *External) CompareAndSetKey(ctx simulation.Context, key string, expected string, state string) (bool, error) {
+	res, err := e.execute(ctx, Command{Kind: CommandCAS, Key: key, Expected: expected, Value: state})
+	return res.Swapped, err
+}
+
+// Transact implements the simulation.ListExternalAPI interface.
+// The whole transaction is a single command, so it is strictly serializable.
+func (e *External) Transact(ctx simulation.Context, txn []simulation.ListOp) ([]simulation.ListOp, error) {
+	res, err := e.execute(ctx, Command{Kind: CommandTxn, Txn: txn})
+	return res.Txn, err
+}
+
+// Restart implements the simulation.Restartable interface.
+// It drops the volatile state of the node of the cluster that runs on the same node as this API.
+func (e *External) Restart() {
+	e.Cluster.Nodes[e.ID].Restart()
+}
+
+// execute runs the given command through the cluster, from the node of this API, and provides its result.
+func (e *External) execute(ctx simulation.Context, cmd Command) (Result, error) {
+	s := e.openSession(ctx)
+	defer e.closeSession(s)
+
+	// Every command gets the next sequence number of its session, so that it takes effect
+	// once, even if it is delivered, or ordered, more than once.
+	s.seq++
+	cmd.Client, cmd.Seq = s.id, s.seq
+	return e.Cluster.execute(ctx, e.ID, cmd, maxHops)
+}
+
+// openSession provides an idle client session, or a new one if there is none.
+func (e *External) openSession(ctx simulation.Context) *session {
+	e.idleMutex.Lock()
+	defer e.idleMutex.Unlock()
+
+	if len(e.idle) == 0 {
+		return &session{id: ctx.NewID()}
+	}
+	s := e.idle[len(e.idle)-1]
+	e.idle = e.idle[:len(e.idle)-1]
+	return s
+}
+
+// closeSession makes the given session idle, once its command returned.
+func (e *External) closeSession(s *session) {
+	e.idleMutex.Lock()
+	defer e.idleMutex.Unlock()
+
+	e.idle = append(e.idle, s)
+}
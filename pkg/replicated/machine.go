@@ -0,0 +1,132 @@
+package replicated
+
+import (
+	"contester/pkg/simulation"
+)
+
+// CommandKind is the kind of a command of the replicated state machine.
+type CommandKind string
+
+const (
+	// CommandNoop does nothing. A new leader uses it to fill the log, or the slots, that it
+	// found empty, so that the commands after them can be applied.
+	CommandNoop CommandKind = "noop"
+	// CommandGet reads a register.
+	CommandGet CommandKind = "get"
+	// CommandSet writes a register.
+	CommandSet CommandKind = "set"
+	// CommandCAS writes a register if it holds the expected value.
+	CommandCAS CommandKind = "cas"
+	// CommandTxn runs a transaction of the list-append workload.
+	CommandTxn CommandKind = "txn"
+)
+
+// Command is an operation of the replicated state machine. Reads are commands too,
+// so that they are ordered with the writes, which makes them linearizable.
+type Command struct {
+	// Client is the ID of the client session that issued the command, and Seq is its
+	// sequence number in that session. Together, they identify the command, so that it
+	// takes effect once, even if the network delivers it more than once, or the protocol
+	// orders it more than once.
+	Client string
+	Seq    uint64
+	Kind   CommandKind
+	// Key of the register.
+	Key string
+	// Value to write, for a set or a cas.
+	Value string
+	// Expected value of the register, for a cas.
+	Expected string
+	// Txn holds the micro-operations of a transaction.
+	Txn []simulation.ListOp
+}
+
+// Result is the outcome of a command.
+type Result struct {
+	// Value of the register, for a get.
+	Value string
+	// Swapped tells whether a cas wrote the register.
+	Swapped bool
+	// Txn holds the micro-operations of a transaction, with the results of the reads filled in.
+	Txn []simulation.ListOp
+}
+
+// Machine is the replicated state machine. Every node applies the commands that the
+// protocol orders to it, in that order, so that all nodes go through the same states.
+type Machine struct {
+	registers map[string]string
+	lists     map[string][]int
+	// sessions holds the last applied command of every client session by the ID of the
+	// session. A session issues a command only once its previous one returned, with the
+	// next sequence number, so the result of its last command is all that is kept. A
+	// command with a sequence number up to that of the last one is not applied again.
+	sessions map[string]lastCommand
+}
+
+// lastCommand is the last applied command of a client session.
+type lastCommand struct {
+	seq    uint64
+	result Result
+}
+
+// NewMachine creates a state machine in its initial state.
+func NewMachine() *Machine {
+	return &Machine{
+		registers: map[string]string{},
+		lists:     map[string][]int{},
+		sessions:  map[string]lastCommand{},
+	}
+}
+
+// Apply runs the given command, unless it ran already.
+func (m *Machine) Apply(cmd Command) {
+	if cmd.Kind == CommandNoop {
+		return
+	}
+	// The command was applied already, or its session moved on without it.
+	if last, exists := m.sessions[cmd.Client]; exists && cmd.Seq <= last.seq {
+		return
+	}
+
+	var res Result
+	switch cmd.Kind {
+	case CommandGet:
+		res.Value = m.registers[cmd.Key]
+	case CommandSet:
+		m.registers[cmd.Key] = cmd.Value
+	case CommandCAS:
+		if m.registers[cmd.Key] == cmd.Expected {
+			m.registers[cmd.Key] = cmd.Value
+			res.Swapped = true
+		}
+	case CommandTxn:
+		res.Txn = m.transact(cmd.Txn)
+	}
+
+	m.sessions[cmd.Client] = lastCommand{seq: cmd.Seq, result: res}
+}
+
+// Result provides the result of the given command, if it was applied.
+func (m *Machine) Result(cmd Command) (Result, bool) {
+	last, exists := m.sessions[cmd.Client]
+	if !exists || last.seq != cmd.Seq {
+		return Result{}, false
+	}
+	return last.result, true
+}
+
+// transact runs the micro-operations of a transaction, and provides them back
+// with the results of the reads filled in.
+func (m *Machine) transact(txn []simulation.ListOp) []simulation.ListOp {
+	ops := make([]simulation.ListOp, len(txn))
+	for i, op := range txn {
+		if op.Kind == simulation.ListAppend {
+			m.lists[op.Key] = append(m.lists[op.Key], op.Value)
+		} else {
+			// The read gets its own copy, as the list keeps growing.
+			op.List = append([]int{}, m.lists[op.Key]...)
+		}
+		ops[i] = op
+	}
+	return ops
+}
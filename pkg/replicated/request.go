@@ -0,0 +1,129 @@
+package replicated
+
+import (
+	"contester/pkg/simulation"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+const (
+	// maxHops is the number of times a request may be passed on to another node, so that
+	// nodes with outdated views of the cluster cannot pass it around forever.
+	maxHops = 2
+	// executeAttempts is the number of times a node tries to get a command to a leader.
+	executeAttempts = 3
+	// leadPolls is the number of times per leader timeout that a node that waits to lead
+	// checks again whether it found a leader, or whether the attempt of another request ended.
+	leadPolls = 20
+)
+
+// execute runs the given command on the given node through the leader, and provides its result.
+//
+// A node that loses track of the leader meanwhile tries again, as it learns about the
+// cluster with every attempt. The command keeps its ID, so it takes effect only once,
+// even if more than one attempt gets it ordered.
+func (c *Cluster) execute(ctx simulation.Context, id simulation.NodeID, cmd Command, hops int) (Result, error) {
+	var res Result
+	var err error
+	for attempt := 0; attempt < executeAttempts; attempt++ {
+		res, err = c.tryExecute(ctx, id, cmd, hops)
+		if !c.retriable(err) {
+			return res, err
+		}
+	}
+	return res, err
+}
+
+// tryExecute gets the given command from the given node to the leader once.
+//
+// If the node leads, it proposes the command itself. If it heard from its leader within
+// the leader timeout, it forwards the command to the leader. Otherwise, it tries to become
+// the leader first. If it fails, for example because its log is outdated or a live leader
+// preempts it, it passes the command on to the node that is more likely to lead. Passing
+// the command on takes a hop, and a command without hops left fails instead.
+//
+// Like with the randomized election timeouts of Raft, a node waits for a while before it
+// tries to lead, which differs per node and epoch, so that nodes rarely try at once, and
+// do not keep preempting each other. A request that finds its node trying to lead already
+// waits for that attempt to end instead.
+func (c *Cluster) tryExecute(ctx simulation.Context, id simulation.NodeID, cmd Command, hops int) (Result, error) {
+	node := c.Nodes[id]
+	poll := c.LeaderTimeout / leadPolls
+
+	var delay, waited time.Duration
+	for first := true; ; first = false {
+		status := node.Status(ctx)
+
+		switch {
+		case status.Leading:
+			return node.Propose(ctx, cmd)
+		case status.Leader != NoNode && hops > 0:
+			return c.forward(ctx, id, status.Leader, cmd, hops-1)
+		}
+
+		if first {
+			delay = c.leadDelay(id, status.Epoch)
+		}
+		if !status.Electing && waited >= delay {
+			break
+		}
+		if waited >= c.LeaderTimeout {
+			return Result{}, ErrNoLeader
+		}
+
+		// Checking again after a while, or once the delay is over.
+		pause := poll
+		if !status.Electing && delay-waited < pause {
+			pause = delay - waited
+		}
+		if err := ctx.Sleep(pause); err != nil {
+			return Result{}, err
+		}
+		waited += pause
+	}
+
+	hint, err := node.Lead(ctx)
+	if err == nil {
+		return node.Propose(ctx, cmd)
+	}
+	if hint == NoNode || hops == 0 {
+		return Result{}, err
+	}
+	return c.forward(ctx, id, hint, cmd, hops-1)
+}
+
+// forward passes the given command on from one node to another, which executes it with the given hops left.
+func (c *Cluster) forward(ctx simulation.Context, from, to simulation.NodeID, cmd Command, hops int) (Result, error) {
+	res, err := ctx.Deliver(from, to, func() (any, error) {
+		return c.execute(ctx, to, cmd, hops)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res.(Result), nil
+}
+
+// retriable tells whether a request that failed with the given error may try again.
+func (c *Cluster) retriable(err error) bool {
+	if errors.Is(err, ErrNotLeader) || errors.Is(err, ErrNoLeader) {
+		return true
+	}
+	for _, retry := range c.Retry {
+		if errors.Is(err, retry) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadDelay provides the time for which the given node waits before it tries to lead
+// after the given epoch. It is below the leader timeout, and it looks random, but it
+// only depends on the node and the epoch, so that runs can be replayed.
+func (c *Cluster) leadDelay(id simulation.NodeID, epoch int64) time.Duration {
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "%d/%d", id, epoch)
+	return time.Duration(hash.Sum64() % uint64(c.LeaderTimeout))
+}
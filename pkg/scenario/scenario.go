@@ -0,0 +1,159 @@
+// Package scenario runs named simulation setups whose outcome is known.
+//
+// A scenario pins a behaviour of an algorithm down, with a config, a cluster and
+// a check of every session. A scenario may also expect its check to fail, which
+// demonstrates a problem, like the one of an older version of an algorithm, right
+// next to the scenario that shows the fix.
+//
+// Algorithms register their scenarios from their init functions, like they
+// register themselves with the simulation.
+package scenario
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Scenario is a simulation setup along with its expected outcome.
+type Scenario struct {
+	// Name identifies the scenario, like "kevlar/lock-offsets".
+	Name string
+	// Description tells what the scenario shows.
+	Description string
+
+	// Algorithm is the name under which the algorithm is registered with the simulation.
+	Algorithm string
+	// Cluster creates the nodes instead of the registered algorithm. It is optional,
+	// and meant for variants of the algorithm that are only kept to demonstrate a
+	// problem, so that they are not registered with the simulation.
+	Cluster simulation.ClusterFactory
+	// NodeCount is the number of nodes in the cluster.
+	NodeCount int
+	// Config of the sessions. Its seed must be set, so that the scenario is reproducible.
+	Config simulation.Config
+	// Sessions is the number of sessions, with consecutive seeds starting at
+	// the seed of the config. A single session is run if it is zero.
+	Sessions int
+
+	// Check judges a session by its report and the error of the simulation. It is
+	// optional. When nil, the session must maintain consensus.
+	Check func(report *simulation.Report, err error) error
+	// ExpectFailure makes the scenario succeed only if the check fails for
+	// at least one session.
+	ExpectFailure bool
+}
+
+// Result of running a scenario.
+type Result struct {
+	// Ok is true if the outcome was the expected one.
+	Ok bool
+	// Sessions is the number of sessions that were run.
+	Sessions int
+	// Failure is the first failure of the check, if any. For a scenario that
+	// expects a failure, it is the demonstration of the problem.
+	Failure error
+}
+
+var (
+	// scenarios holds all registered scenarios by name.
+	scenarios      = map[string]Scenario{}
+	scenariosMutex = &sync.RWMutex{}
+)
+
+// Register makes the given scenario available under its name.
+//
+// It is meant to be called from the init function of the package that implements
+// the algorithm. It panics if the name is already taken.
+func Register(s Scenario) {
+	scenariosMutex.Lock()
+	defer scenariosMutex.Unlock()
+
+	if _, exists := scenarios[s.Name]; exists {
+		panic("scenario: Register called twice for " + s.Name)
+	}
+
+	scenarios[s.Name] = s
+}
+
+// Lookup provides the scenario that is registered under the given name.
+func Lookup(name string) (Scenario, error) {
+	scenariosMutex.RLock()
+	defer scenariosMutex.RUnlock()
+
+	s, exists := scenarios[name]
+	if !exists {
+		return Scenario{}, fmt.Errorf("unknown scenario %q, registered scenarios: %v", name, registeredNames())
+	}
+	return s, nil
+}
+
+// Names provides the sorted names of all registered scenarios.
+func Names() []string {
+	scenariosMutex.RLock()
+	defer scenariosMutex.RUnlock()
+
+	return registeredNames()
+}
+
+// registeredNames provides the sorted names of all registered scenarios.
+// The caller must hold the scenarios mutex.
+func registeredNames() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Run runs the sessions of the given scenario, and judges the outcome.
+//
+// A scenario that expects no failure stops at the first failing session, and
+// a scenario that expects a failure stops at the first session that shows it.
+// It returns an error if a session could not run at all.
+func Run(s Scenario) (*Result, error) {
+	factory := s.Cluster
+	if factory == nil {
+		var err error
+		if factory, err = simulation.Lookup(s.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+	if s.Config.Seed == 0 {
+		return nil, fmt.Errorf("scenario %s has no seed", s.Name)
+	}
+
+	sessions := s.Sessions
+	if sessions == 0 {
+		sessions = 1
+	}
+
+	check := s.Check
+	if check == nil {
+		check = func(_ *simulation.Report, err error) error { return err }
+	}
+
+	result := &Result{}
+	conf := s.Config
+	for i := 0; i < sessions; i++ {
+		conf.Seed = s.Config.Seed + int64(i)
+
+		report, errRun := simulation.RunWithReport(conf, factory(s.NodeCount))
+		// A run without report could not run at all.
+		if report == nil {
+			return nil, errRun
+		}
+		result.Sessions++
+
+		if errCheck := check(report, errRun); errCheck != nil {
+			result.Failure = errCheck
+			break
+		}
+	}
+
+	result.Ok = (result.Failure != nil) == s.ExpectFailure
+	return result, nil
+}
@@ -0,0 +1,375 @@
+// Package shrink reduces failing simulation runs to minimal counterexamples.
+//
+// A failing run of the simulation is usually full of noise: many requests, many
+// nodes and many faults, most of which have nothing to do with the failure. The
+// shrinker replays the run with its seed, and repeatedly tries smaller variants
+// of it, keeping every variant that still fails.
+package shrink
+
+import (
+	"contester/pkg/nemesis"
+	"contester/pkg/simulation"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result of shrinking a failing run.
+type Result struct {
+	// Config of the smallest failing run. If its faults could be replayed,
+	// the random faults are disabled and the Nemesis holds all the faults.
+	Config simulation.Config
+	// NodeCount of the smallest failing run.
+	NodeCount int
+	// Schedule of the faults of the smallest failing run, which the Config replays.
+	// It is nil if the faults could not be replayed.
+	Schedule nemesis.Schedule
+	// ReplayFailed is true if replaying the recorded faults of the original run did
+	// not reproduce its failure. The random faults of the Config are then kept, and
+	// cannot be removed one by one.
+	ReplayFailed bool
+	// History of the smallest failing run.
+	History *simulation.History
+	// Report of the smallest failing run.
+	Report *simulation.Report
+	// Err is the failure of the smallest failing run.
+	Err error
+	// Runs is the number of simulation runs that shrinking took.
+	Runs int
+}
+
+// candidate is a variant of the failing run.
+type candidate struct {
+	conf      simulation.Config
+	nodeCount int
+	// schedule holds all the faults of the run, if they are replayed explicitly.
+	// Otherwise, it is nil, and the config injects the faults.
+	schedule nemesis.Schedule
+}
+
+// failureKind is the way in which a run failed.
+type failureKind string
+
+const (
+	// failureBroken means that the checker found the history broken.
+	failureBroken failureKind = "broken history"
+	// failureStalled means that the simulation stalled.
+	failureStalled failureKind = "stalled"
+	// failureUnchecked means that the history could not be checked, for example
+	// because the final read failed.
+	failureUnchecked failureKind = "unchecked"
+)
+
+// failureClass tells how a run failed. Shrinking only keeps the variants that fail
+// like the original run, so that a broken history does not shrink into a run that
+// merely could not complete.
+type failureClass struct {
+	kind failureKind
+	// anomalies holds the sorted kinds of the anomalies of a broken list-append history.
+	anomalies string
+}
+
+// classify provides the class of the failure of the run with the given report and error.
+func classify(report *simulation.Report, err error) failureClass {
+	switch {
+	case errors.Is(err, simulation.ErrStalled):
+		return failureClass{kind: failureStalled}
+	case report.Verdict.Checked && !report.Verdict.Linearizable:
+		var kinds []string
+		seen := map[string]bool{}
+		for _, anomaly := range report.Verdict.Anomalies {
+			if kind := string(anomaly.Kind); !seen[kind] {
+				seen[kind] = true
+				kinds = append(kinds, kind)
+			}
+		}
+		sort.Strings(kinds)
+		return failureClass{kind: failureBroken, anomalies: strings.Join(kinds, ",")}
+	default:
+		return failureClass{kind: failureUnchecked}
+	}
+}
+
+// shrinker holds the state of a shrinking.
+type shrinker struct {
+	factory simulation.ClusterFactory
+	// class of the failure of the original run. It is nil until the original run failed.
+	class *failureClass
+	// current is the smallest failing candidate so far.
+	current candidate
+	// result of the current candidate.
+	result *Result
+}
+
+// Shrink reduces the failing run with the given config and number of nodes. The
+// config must have a seed, and the run must fail with it.
+//
+// It tries fewer requests, fewer nodes, fewer faults, and less network and clock
+// noise, for as long as any of these reductions keeps the run failing the same way.
+// A broken history only shrinks into smaller broken histories, with the same kinds
+// of anomalies for the list-append workload, and a stall only into smaller stalls.
+func Shrink(factory simulation.ClusterFactory, conf simulation.Config, nodeCount int) (*Result, error) {
+	if conf.Seed == 0 {
+		return nil, fmt.Errorf("a seed is required to shrink a run")
+	}
+
+	s := &shrinker{factory: factory, result: &Result{}}
+
+	// The original run must fail.
+	if !s.try(candidate{conf: conf, nodeCount: nodeCount}) {
+		if s.result.Err != nil {
+			return nil, s.result.Err
+		}
+		return nil, fmt.Errorf("simulation with seed %d does not fail", conf.Seed)
+	}
+
+	// Faults can only be removed one by one if they are injected explicitly.
+	// So, replay the recorded faults instead of the random ones, which works
+	// as long as the run still fails.
+	replay := candidate{
+		conf:      withoutRandomFaults(conf),
+		nodeCount: nodeCount,
+		schedule:  nemesis.FromFaults(s.result.History.Faults),
+	}
+	replayed := s.try(replay)
+
+	// Keep shrinking until no reduction works anymore.
+	for progress := true; progress; {
+		progress = s.shrinkRequests()
+		progress = s.shrinkNodes() || progress
+		progress = s.shrinkFaults() || progress
+		progress = s.shrinkNoise() || progress
+	}
+
+	// Only a schedule that was run, and failed, is provided.
+	s.result.Schedule = s.current.schedule
+	s.result.ReplayFailed = !replayed
+	return s.result, nil
+}
+
+// try runs the given candidate, and makes it the current one if it fails like
+// the original run. It returns true if it did.
+func (s *shrinker) try(c candidate) bool {
+	s.result.Runs++
+
+	conf := c.conf
+	if c.schedule != nil {
+		conf.Nemesis = c.schedule
+	}
+
+	report, err := simulation.RunWithReport(conf, s.factory(c.nodeCount))
+	// A run without report could not run at all, which is no failure of the algorithm.
+	if report == nil {
+		if s.result.History == nil {
+			s.result.Err = err
+		}
+		return false
+	}
+	if err == nil {
+		return false
+	}
+
+	class := classify(report, err)
+	if s.class == nil {
+		s.class = &class
+	} else if class != *s.class {
+		return false
+	}
+
+	s.current = c
+	s.result = &Result{
+		Config:    conf,
+		NodeCount: c.nodeCount,
+		History:   report.History,
+		Report:    report,
+		Err:       err,
+		Runs:      s.result.Runs,
+	}
+	return true
+}
+
+// shrinkRequests tries to remove requests. It returns true if any were removed.
+func (s *shrinker) shrinkRequests() bool {
+	var progress bool
+
+	// Remove large numbers of requests first, then fewer and fewer.
+	for step := s.current.conf.RequestCount / 2; step >= 1; {
+		c := s.current
+		c.conf.RequestCount -= step
+
+		// The simulation needs at least 2 requests.
+		if c.conf.RequestCount >= 2 && s.try(c) {
+			progress = true
+			continue
+		}
+		step /= 2
+	}
+
+	return progress
+}
+
+// shrinkNodes tries to remove nodes. It returns true if any were removed.
+func (s *shrinker) shrinkNodes() bool {
+	// Try the smallest clusters first.
+	for nodeCount := 1; nodeCount < s.current.nodeCount; nodeCount++ {
+		c := s.current
+		c.nodeCount = nodeCount
+		if c.schedule != nil {
+			c.schedule = restrict(c.schedule, nodeCount)
+		}
+
+		if s.try(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shrinkFaults tries to remove faults, if they are injected explicitly.
+// It returns true if any were removed.
+func (s *shrinker) shrinkFaults() bool {
+	var progress bool
+
+	// Remove the whole schedule first, then smaller and smaller chunks of it.
+	for size := len(s.current.schedule); size >= 1; size /= 2 {
+		for start := 0; start < len(s.current.schedule); {
+			c := s.current
+			c.schedule = remove(c.schedule, start, size)
+
+			// On success, the next chunk takes the place of the removed one.
+			if s.try(c) {
+				progress = true
+				continue
+			}
+			start += size
+		}
+	}
+
+	return progress
+}
+
+// shrinkNoise tries to turn off the random network and clock faults, one by one,
+// and to use a single key and plain writes only. It returns true if any of these worked.
+func (s *shrinker) shrinkNoise() bool {
+	reductions := []func(conf *simulation.Config) bool{
+		func(conf *simulation.Config) bool {
+			// A single key needs no keyed API, but it may still fail.
+			return conf.KeyCount > 1 && reset(&conf.KeyCount)
+		},
+		func(conf *simulation.Config) bool {
+			// Plain writes may still fail.
+			return reset(&conf.CASRatio)
+		},
+		func(conf *simulation.Config) bool {
+			return reset(&conf.NetworkFailureProbability)
+		},
+		func(conf *simulation.Config) bool {
+			return reset(&conf.NetworkDuplicateProbability)
+		},
+		func(conf *simulation.Config) bool {
+			return reset(&conf.NetworkReorderProbability)
+		},
+		func(conf *simulation.Config) bool {
+			return reset(&conf.MaxClockOffset)
+		},
+		func(conf *simulation.Config) bool {
+			return reset(&conf.MaxClockDrift)
+		},
+		func(conf *simulation.Config) bool {
+			minReset, maxReset := reset(&conf.NetworkMinDelay), reset(&conf.NetworkMaxDelay)
+			return minReset || maxReset
+		},
+	}
+
+	var progress bool
+	for _, reduce := range reductions {
+		c := s.current
+		// Skip the reductions that change nothing.
+		if reduce(&c.conf) && s.try(c) {
+			progress = true
+		}
+	}
+
+	return progress
+}
+
+// withoutRandomFaults provides the given config with all random fault
+// injection disabled. The random network and clock noise is left as it is.
+func withoutRandomFaults(conf simulation.Config) simulation.Config {
+	conf.PartitionKinds = nil
+	conf.CrashDuration = 0
+	conf.MaxClockJump = 0
+	conf.Nemesis = nil
+	return conf
+}
+
+// restrict provides the given schedule without the faults that concern nodes
+// that do not exist in a cluster of the given size.
+func restrict(schedule nemesis.Schedule, nodeCount int) nemesis.Schedule {
+	restricted := nemesis.Schedule{}
+	exists := func(node simulation.NodeID) bool { return int(node) < nodeCount }
+
+	for _, event := range schedule {
+		switch action := event.Action.(type) {
+		case nemesis.Partition:
+			var groups [][]simulation.NodeID
+			for _, group := range action.Groups {
+				var kept []simulation.NodeID
+				for _, node := range group {
+					if exists(node) {
+						kept = append(kept, node)
+					}
+				}
+				if len(kept) > 0 {
+					groups = append(groups, kept)
+				}
+			}
+			// A partition of removed nodes only is left out.
+			if len(groups) == 0 {
+				continue
+			}
+			event.Action = nemesis.Partition{Groups: groups}
+		case nemesis.Crash:
+			if !exists(action.Node) {
+				continue
+			}
+		case nemesis.Restart:
+			if !exists(action.Node) {
+				continue
+			}
+		case nemesis.ClockJump:
+			if !exists(action.Node) {
+				continue
+			}
+		}
+
+		restricted = append(restricted, event)
+	}
+
+	return restricted
+}
+
+// remove provides the given schedule without the given number of events from the given start.
+func remove(schedule nemesis.Schedule, start, count int) nemesis.Schedule {
+	end := start + count
+	if end > len(schedule) {
+		end = len(schedule)
+	}
+
+	removed := make(nemesis.Schedule, 0, len(schedule)-(end-start))
+	removed = append(removed, schedule[:start]...)
+	return append(removed, schedule[end:]...)
+}
+
+// reset sets the given value to zero. It returns false if it already was zero.
+func reset[T comparable](value *T) bool {
+	var zero T
+	if *value == zero {
+		return false
+	}
+
+	*value = zero
+	return true
+}
@@ -0,0 +1,102 @@
+package shrink
+
+import (
+	"contester/pkg/elle"
+	"contester/pkg/naive"
+	"contester/pkg/simulation"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	broken := func(kinds ...elle.AnomalyKind) *simulation.Report {
+		report := &simulation.Report{Verdict: simulation.Verdict{Checked: true}}
+		for _, kind := range kinds {
+			report.Verdict.Anomalies = append(report.Verdict.Anomalies, elle.Anomaly{Kind: kind})
+		}
+		return report
+	}
+	errBroken := errors.New("consensus broken")
+
+	tests := []struct {
+		name   string
+		report *simulation.Report
+		err    error
+		want   failureClass
+	}{
+		{
+			name:   "stall",
+			report: &simulation.Report{},
+			err:    fmt.Errorf("simulation with seed 1 failed: %w", simulation.ErrStalled),
+			want:   failureClass{kind: failureStalled},
+		},
+		{
+			name:   "failed final read",
+			report: &simulation.Report{},
+			err:    errors.New("failed to get state: no consensus on any value"),
+			want:   failureClass{kind: failureUnchecked},
+		},
+		{
+			name:   "non-linearizable register history",
+			report: broken(),
+			err:    errBroken,
+			want:   failureClass{kind: failureBroken},
+		},
+		{
+			name:   "anomalies are sorted and unique",
+			report: broken(elle.G2, elle.GSingle, elle.G2),
+			err:    errBroken,
+			want:   failureClass{kind: failureBroken, anomalies: "G-single,G2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classify(test.report, test.err); got != test.want {
+				t.Errorf("classify() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShrinkReplaysBridgeAndRingPartitions(t *testing.T) {
+	conf := simulation.QuickStartConfig
+	conf.RequestCount = 30
+	conf.PartitionInterval = time.Millisecond / 2
+	conf.PartitionDuration = time.Millisecond / 2
+	conf.PartitionKinds = []simulation.PartitionKind{simulation.PartitionBridge, simulation.PartitionRing}
+	conf.Seed = 42
+
+	// The original run must have both kinds of partitions.
+	original, err := simulation.RunWithHistory(conf, naive.NewCluster(5))
+	if err == nil {
+		t.Fatal("RunWithHistory() error = nil, want a failing run")
+	}
+	kinds := map[simulation.PartitionKind]bool{}
+	for _, fault := range original.Faults {
+		if fault.Kind == simulation.FaultPartition {
+			kinds[fault.Partition.Kind] = true
+		}
+	}
+	if !kinds[simulation.PartitionBridge] || !kinds[simulation.PartitionRing] {
+		t.Fatalf("original run has partitions %v, want bridge and ring", kinds)
+	}
+
+	result, err := Shrink(naive.NewCluster, conf, 5)
+	if err != nil {
+		t.Fatalf("Shrink() error = %v", err)
+	}
+	if result.ReplayFailed || result.Schedule == nil {
+		t.Fatalf("Shrink() did not replay the recorded faults, schedule = %v", result.Schedule)
+	}
+
+	// The schedule reproduces the failure.
+	conf = result.Config
+	conf.Nemesis = result.Schedule
+	report, err := simulation.RunWithReport(conf, naive.NewCluster(result.NodeCount))
+	if report == nil || err == nil || err.Error() != result.Err.Error() {
+		t.Errorf("replay of the schedule %q failed with %v, want %v", result.Schedule, err, result.Err)
+	}
+}
@@ -0,0 +1,45 @@
+package simulation
+
+import (
+	"fmt"
+)
+
+// casWindow is the number of most recent writes of the workload that a
+// compare-and-set request picks its expected value from. Recent values are
+// likely to be current, so that a fair share of the requests succeed.
+const casWindow = 4
+
+// CASExternalAPI is an ExternalAPI whose register also supports conditional writes.
+//
+// If the Config asks for compare-and-set requests, every instance must implement
+// it, and the register is checked against the compare-and-set register model.
+type CASExternalAPI interface {
+	ExternalAPI
+	// CompareAndSet sets the state of the system to the new state, only if it
+	// currently is the expected state. It reports whether the state was set,
+	// and returns an error if something goes wrong.
+	//
+	// A call that returns an error may or may not have set the state.
+	CompareAndSet(ctx Context, expected string, new string) (swapped bool, err error)
+}
+
+// validateCASInstances checks that the instances support the compare-and-set
+// requests of the config, if there are any.
+func validateCASInstances(conf Config, instances []ExternalAPI) error {
+	if conf.CASRatio == 0 {
+		return nil
+	}
+
+	for i, instance := range instances {
+		if _, ok := instance.(CASExternalAPI); !ok {
+			return fmt.Errorf("instance %d does not implement CASExternalAPI, which is required for a CAS ratio > 0", i)
+		}
+	}
+
+	return nil
+}
+
+// compareAndSet calls the CompareAndSet method of the instance.
+func compareAndSet(ctx Context, instance ExternalAPI, expected string, new string) (bool, error) {
+	return instance.(CASExternalAPI).CompareAndSet(ctx, expected, new)
+}
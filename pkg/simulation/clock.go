@@ -0,0 +1,107 @@
+package simulation
+
+import (
+	"sync"
+	"time"
+)
+
+// clock is the local clock of a node.
+//
+// It reads the simulated time with a stable offset, runs slightly faster or
+// slower than the simulated time as per its drift, and may be stepped at any
+// point, like an NTP correction would.
+type clock struct {
+	// offset is the constant difference from the simulated time.
+	offset time.Duration
+	// drift is the rate at which the clock gains (or loses, if negative) time.
+	// For example, a drift of 0.001 gains a millisecond every second.
+	drift float64
+	// steps is the sum of all the steps that the clock has taken.
+	steps time.Duration
+}
+
+// read the clock at the given simulated time, relative to the start of the simulation.
+func (c *clock) read(now time.Duration) time.Time {
+	return simulationEpoch.Add(c.monotonic(now) + c.offset + c.steps)
+}
+
+// monotonic reads the monotonic clock at the given simulated time. It drifts
+// like the clock, but it has neither the offset nor the steps of the clock.
+func (c *clock) monotonic(now time.Duration) time.Duration {
+	return now + time.Duration(float64(now)*c.drift)
+}
+
+// clockSet holds the clocks of all nodes. It is safe for concurrent use.
+type clockSet struct {
+	clocks     []*clock
+	clockMutex *sync.RWMutex
+}
+
+// newClockSet creates a clock for each node, with a random offset and drift as per the config.
+func newClockSet(conf Config, nodeCount int, r *random) *clockSet {
+	clocks := make([]*clock, nodeCount)
+	for i := range clocks {
+		clocks[i] = &clock{
+			offset: r.durationBetween(0, conf.MaxClockOffset),
+			drift:  r.float64Between(-conf.MaxClockDrift, conf.MaxClockDrift),
+		}
+	}
+
+	return &clockSet{clocks: clocks, clockMutex: &sync.RWMutex{}}
+}
+
+// read the clock of the given node at the given simulated time.
+//
+// Nodes that are unknown to the simulation read the simulated time as it is.
+func (c *clockSet) read(node NodeID, now time.Duration) time.Time {
+	c.clockMutex.RLock()
+	defer c.clockMutex.RUnlock()
+
+	if node < 0 || int(node) >= len(c.clocks) {
+		return simulationEpoch.Add(now)
+	}
+	return c.clocks[node].read(now)
+}
+
+// monotonic reads the monotonic clock of the given node at the given simulated time.
+//
+// Nodes that are unknown to the simulation read the simulated time as it is.
+func (c *clockSet) monotonic(node NodeID, now time.Duration) time.Duration {
+	c.clockMutex.RLock()
+	defer c.clockMutex.RUnlock()
+
+	if node < 0 || int(node) >= len(c.clocks) {
+		return now
+	}
+	return c.clocks[node].monotonic(now)
+}
+
+// step the clock of the given node by the given amount.
+func (c *clockSet) step(node NodeID, amount time.Duration) {
+	c.clockMutex.Lock()
+	defer c.clockMutex.Unlock()
+
+	c.clocks[node].steps += amount
+}
+
+// startClockJumps starts stepping the clock of a random node at regular
+// intervals, as per the config, using the given injector.
+//
+// Jumps keep coming until the injector is stopped. It must be called by the
+// goroutine that runs the scheduler.
+func startClockJumps(in *injector) {
+	// Short hand for config.
+	conf := in.ctx.conf
+	// Jumps follow their own random decisions.
+	r := in.ctx.random.derive(clockJumpRandomKey)
+
+	var jump func()
+
+	jump = func() {
+		node := NodeID(r.intn(in.NodeCount()))
+		in.JumpClock(node, r.durationBetween(-conf.MaxClockJump, conf.MaxClockJump))
+		in.after(conf.ClockJumpInterval, jump)
+	}
+
+	in.after(conf.ClockJumpInterval, jump)
+}
@@ -8,35 +8,98 @@ import (
 // idealConfig is the config for an ideal simulation where there
 // are no network faults, and different clocks never go out of sync.
 var idealConfig = Config{
-	RequestCount:              0, // NO NEED TO SET.
-	RequestInterval:           0, // NO NEED TO SET.
-	NetworkFailureProbability: 0, // Perfectly stable networks.
-	NetworkMinDelay:           0, // Infinite speed.
-	NetworkMaxDelay:           0, // Infinite speed.
-	MaxClockOffset:            0, // Perfectly synced clocks.
+	RequestCount:                0,   // NO NEED TO SET.
+	RequestInterval:             0,   // NO NEED TO SET.
+	Workload:                    "",  // NO NEED TO SET.
+	KeyCount:                    0,   // NO NEED TO SET.
+	ReadRatio:                   0,   // NO NEED TO SET.
+	CASRatio:                    0,   // NO NEED TO SET.
+	MaxTransactionLength:        0,   // NO NEED TO SET.
+	NetworkFailureProbability:   0,   // Perfectly stable networks.
+	NetworkMinDelay:             0,   // Infinite speed.
+	NetworkMaxDelay:             0,   // Infinite speed.
+	NetworkDuplicateProbability: 0,   // No duplicates.
+	NetworkReorderProbability:   0,   // Messages arrive in order.
+	MaxClockOffset:              0,   // Perfectly synced clocks.
+	MaxClockDrift:               0,   // Perfectly synced clocks.
+	MaxClockJump:                0,   // Perfectly synced clocks.
+	PartitionKinds:              nil, // No partitions.
+	CrashDuration:               0,   // No crashes.
 }
 
 // QuickStartConfig to get started with a simulation.
 var QuickStartConfig = Config{
-	RequestCount:              10,
-	RequestInterval:           time.Microsecond,
-	NetworkFailureProbability: 0.1,
-	NetworkMinDelay:           time.Millisecond / 10,
-	NetworkMaxDelay:           time.Millisecond,
-	MaxClockOffset:            10 * time.Millisecond,
+	RequestCount:                10,
+	RequestInterval:             time.Microsecond,
+	Workload:                    WorkloadRegister,
+	KeyCount:                    1,
+	ReadRatio:                   0.5,
+	CASRatio:                    0,
+	MaxTransactionLength:        4,
+	NetworkFailureProbability:   0.1,
+	NetworkMinDelay:             time.Millisecond / 10,
+	NetworkMaxDelay:             time.Millisecond,
+	NetworkDuplicateProbability: 0.05,
+	NetworkReorderProbability:   0.1,
+	NetworkReorderWindow:        time.Millisecond,
+	MaxClockOffset:              10 * time.Millisecond,
+	MaxClockDrift:               0.001,
+	MaxClockJump:                10 * time.Millisecond,
+	ClockJumpInterval:           5 * time.Millisecond,
+	PartitionKinds:              PartitionKinds,
+	PartitionInterval:           2 * time.Millisecond,
+	PartitionDuration:           3 * time.Millisecond,
+	CrashInterval:               2 * time.Millisecond,
+	CrashDuration:               4 * time.Millisecond,
+	CrashAmnesia:                false,
 }
 
 // Config for the simulation.
 type Config struct {
+	// Seed drives every random decision of the simulation, like failures,
+	// delays, clock offsets and generated values.
+	//
+	// If it is zero, a random seed is picked. The seed in use is always part
+	// of the error returned for a failed run, so that the run can be replayed.
+	Seed int64
 	// RequestCount is the total number of requests
 	// that will be fed to the system.
 	RequestCount int64
-	// RequestInterval is the delay between two consecutive requests.
+	// RequestInterval is the simulated delay between two consecutive requests.
 	//
-	// This should be set, otherwise the delay between two consecutive
-	// requests could be in nanoseconds (since it is all IPC), which
-	// would make their true order difficult to detect.
+	// This should be set, otherwise all requests would be sent at the
+	// same simulated time, which would make their true order impossible
+	// to detect.
 	RequestInterval time.Duration
+	// Workload is the kind of requests to send. The register workload is used
+	// if it is empty.
+	//
+	// The list-append workload requires every instance to implement
+	// ListExternalAPI. Its transactions are spread across the keys, and
+	// they append or read as per the read ratio.
+	Workload Workload
+	// KeyCount is the number of keys that the requests are spread across.
+	//
+	// If it is more than 1, every instance must implement KeyedExternalAPI,
+	// and every key is checked as an independent register. Otherwise, the
+	// single register of the ExternalAPI is used.
+	KeyCount int
+	// ReadRatio is a number in the interval [0, 1] and represents the
+	// probability of a request being a Get instead of a Set.
+	//
+	// Reads run concurrently with the writes on all nodes, and their
+	// results are validated along with everything else.
+	ReadRatio float64
+	// CASRatio is a number in the interval [0, 1] and represents the
+	// probability of a write being a CompareAndSet instead of a Set.
+	//
+	// If it is more than 0, every instance must implement CASExternalAPI.
+	// Compare-and-set requests only work with a single key.
+	CASRatio float64
+	// MaxTransactionLength is the maximum number of micro-operations in a
+	// transaction of the list-append workload. Every transaction gets a random
+	// length between 1 and it.
+	MaxTransactionLength int
 	// NetworkFailureProbability is a number in the interval [0, 1]
 	// and represents the failure probability of a network operation.
 	NetworkFailureProbability float64
@@ -44,9 +107,56 @@ type Config struct {
 	NetworkMinDelay time.Duration
 	// NetworkMaxDelay is the maximum delay of a network operation.
 	NetworkMaxDelay time.Duration
+	// NetworkDuplicateProbability is a number in the interval [0, 1] and
+	// represents the probability of a delivered request being delivered
+	// once more, later, like a stale message replayed by the network.
+	NetworkDuplicateProbability float64
+	// NetworkReorderProbability is a number in the interval [0, 1] and
+	// represents the probability of a message being held back, so that
+	// the messages sent after it over the same link can overtake it.
+	NetworkReorderProbability float64
+	// NetworkReorderWindow is the maximum extra delay of a held back message.
+	NetworkReorderWindow time.Duration
 	// MaxClockOffset is the maximum offset a clock can have in the
 	// simulation, as no two systems have perfectly synced clocks.
+	// Every node gets a random, but stable, offset.
 	MaxClockOffset time.Duration
+	// MaxClockDrift is the maximum rate at which a clock can gain or
+	// lose time. For example, 0.001 means a millisecond every second.
+	// Every node gets a random, but stable, drift.
+	MaxClockDrift float64
+	// MaxClockJump is the maximum amount by which a clock can be stepped
+	// forward or backward, like an NTP correction would do it. Jumps are
+	// disabled if it is zero.
+	MaxClockJump time.Duration
+	// ClockJumpInterval is the simulated time between two clock jumps,
+	// each of which steps the clock of a random node.
+	ClockJumpInterval time.Duration
+
+	// PartitionKinds are the kinds of network partitions that the simulation
+	// picks from at random. Partitions are disabled if it is empty.
+	PartitionKinds []PartitionKind
+	// PartitionInterval is the simulated time for which the network stays
+	// healthy before a partition.
+	PartitionInterval time.Duration
+	// PartitionDuration is the simulated time for which a partition lasts.
+	PartitionDuration time.Duration
+
+	// CrashInterval is the simulated time for which all nodes stay up
+	// before a random node crashes.
+	CrashInterval time.Duration
+	// CrashDuration is the simulated time for which a crashed node stays
+	// down. All operations on it fail meanwhile. Crashes are disabled if
+	// it is zero.
+	CrashDuration time.Duration
+	// CrashAmnesia makes crashed nodes lose their in-memory state when
+	// they come back up. It only affects instances that implement the
+	// Restartable interface.
+	CrashAmnesia bool
+
+	// Nemesis injects faults as per its own timeline, in addition to the
+	// random faults above. It is optional.
+	Nemesis Nemesis
 }
 
 // validate the user provided config.
@@ -59,6 +169,34 @@ func (c Config) validate() error {
 		return fmt.Errorf("request interval must be > 0")
 	}
 
+	if err := c.Workload.validate(); err != nil {
+		return err
+	}
+
+	if c.KeyCount < 0 {
+		return fmt.Errorf("key count cannot be negative")
+	}
+
+	if c.ReadRatio < 0 || c.ReadRatio > 1 {
+		return fmt.Errorf("read ratio must be in the interval [0, 1]")
+	}
+
+	if c.CASRatio < 0 || c.CASRatio > 1 {
+		return fmt.Errorf("CAS ratio must be in the interval [0, 1]")
+	}
+
+	if c.CASRatio > 0 && c.KeyCount > 1 {
+		return fmt.Errorf("CAS ratio must be 0 when the key count is > 1")
+	}
+
+	if c.CASRatio > 0 && c.Workload == WorkloadListAppend {
+		return fmt.Errorf("CAS ratio must be 0 for the %s workload", WorkloadListAppend)
+	}
+
+	if c.MaxTransactionLength < 0 {
+		return fmt.Errorf("max transaction length cannot be negative")
+	}
+
 	if c.NetworkFailureProbability < 0 || c.NetworkFailureProbability > 1 {
 		return fmt.Errorf("network failure probability must be in the interval [0, 1]")
 	}
@@ -71,9 +209,51 @@ func (c Config) validate() error {
 		return fmt.Errorf("network delays cannot be negative")
 	}
 
+	if c.NetworkDuplicateProbability < 0 || c.NetworkDuplicateProbability > 1 {
+		return fmt.Errorf("network duplicate probability must be in the interval [0, 1]")
+	}
+
+	if c.NetworkReorderProbability < 0 || c.NetworkReorderProbability > 1 {
+		return fmt.Errorf("network reorder probability must be in the interval [0, 1]")
+	}
+
+	if c.NetworkReorderWindow < 0 {
+		return fmt.Errorf("network reorder window cannot be negative")
+	}
+
 	if c.MaxClockOffset < 0 {
 		return fmt.Errorf("max clock offset cannot be negative")
 	}
 
+	if c.MaxClockDrift < 0 || c.MaxClockDrift >= 1 {
+		return fmt.Errorf("max clock drift must be in the interval [0, 1)")
+	}
+
+	if c.MaxClockJump < 0 {
+		return fmt.Errorf("max clock jump cannot be negative")
+	}
+
+	if c.MaxClockJump > 0 && c.ClockJumpInterval <= 0 {
+		return fmt.Errorf("clock jump interval must be > 0 when clock jumps are enabled")
+	}
+
+	for _, kind := range c.PartitionKinds {
+		if err := kind.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.PartitionKinds) > 0 && (c.PartitionInterval <= 0 || c.PartitionDuration <= 0) {
+		return fmt.Errorf("partition interval and duration must be > 0 when partitions are enabled")
+	}
+
+	if c.CrashDuration < 0 {
+		return fmt.Errorf("crash duration cannot be negative")
+	}
+
+	if c.CrashDuration > 0 && c.CrashInterval <= 0 {
+		return fmt.Errorf("crash interval must be > 0 when crashes are enabled")
+	}
+
 	return nil
 }
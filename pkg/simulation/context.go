@@ -3,6 +3,7 @@ package simulation
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,30 +21,244 @@ type Context interface {
 	// in an actual system.
 	NetworkOp() error
 
-	// Time provides the current time that is offset as per
-	// the simulaton's configs.
+	// NetworkOpTo is like NetworkOp, but for a message that travels
+	// from one node to another. It allows the simulation to apply
+	// faults, like partitions, per link.
+	//
+	// An ExternalAPI implementation that knows the identities of its
+	// nodes should prefer this method over NetworkOp.
+	NetworkOpTo(from, to NodeID) error
+
+	// Deliver sends a request message from one node to another, runs
+	// the handler on the receiving node when the request arrives, and
+	// sends the result of the handler back as a response message.
+	//
+	// Unlike NetworkOp, the simulation owns the whole delivery here. It
+	// may lose either message, delay them, reorder them with the other
+	// messages over the same link, or even deliver the request again
+	// later. The results of such duplicate deliveries are discarded.
+	//
+	// An ExternalAPI implementation should prefer this method for all
+	// IPC, with the handler doing the work of the receiving node.
+	Deliver(from, to NodeID, handler func() (any, error)) (any, error)
+
+	// Concurrently calls the given function once for every index from 0
+	// to n-1, each call in its own goroutine, and returns once all calls
+	// have returned.
+	//
+	// An ExternalAPI implementation should call this method instead of
+	// using the go statement, and wait for concurrent calls with it
+	// instead of with channels or sync.WaitGroup. The simulation lets
+	// simulated time pass once all of its goroutines wait on it, so it
+	// must know about every goroutine, and about everything it waits on.
+	Concurrently(n int, call func(i int))
+
+	// NewID provides a new random identifier, in the form of a UUID. It is
+	// drawn from the seed of the simulation, so that runs can be replayed.
+	//
+	// An ExternalAPI implementation should call this method instead of
+	// generating identifiers itself, like the IDs of locks or requests.
+	NewID() string
+
+	// Sleep pauses the caller for the given duration of simulated time.
+	//
+	// An ExternalAPI implementation should call this method instead
+	// of time.Sleep. It returns an error if the simulation is over.
+	Sleep(duration time.Duration) error
+
+	// Time provides the current time as per the clock of the node
+	// that received the request being served.
 	Time() time.Time
+
+	// TimeOf provides the current time as per the clock of the given
+	// node. Every node has its own clock, with a stable offset, a drift
+	// and possible jumps, as per the simulation's configs.
+	//
+	// An ExternalAPI implementation should call this method instead of
+	// Time when it knows the node on which the code runs.
+	TimeOf(node NodeID) time.Time
+
+	// Monotonic provides the reading of the monotonic clock of the node
+	// that received the request being served.
+	Monotonic() time.Duration
+
+	// MonotonicOf provides the reading of the monotonic clock of the given
+	// node, like the monotonic reading of time.Now in Go. It runs with the
+	// drift of the node's clock, but it has no offset and it never jumps.
+	//
+	// Readings are only comparable with other readings of the same node. So,
+	// an ExternalAPI implementation should use it to measure durations on a
+	// node, like the leases of locks, and never send it to other nodes.
+	MonotonicOf(node NodeID) time.Duration
 }
 
 // kontext implements the Context interface.
 type kontext struct {
 	context.Context
 
-	conf Config
+	conf   Config
+	random *random
+	sched  *scheduler
+	net    *network
+	clocks *clockSet
+	// messages counts the messages of the session.
+	messages *messageCounter
+
+	// node is the node that received the request being served.
+	node NodeID
+}
+
+// messageCounter counts the messages of a session. It is shared by all copies of
+// the context of the session.
+type messageCounter struct {
+	sent, delivered, dropped, duplicated atomic.Int64
+}
+
+// snapshot provides the current counts.
+func (c *messageCounter) snapshot() Messages {
+	return Messages{
+		Sent:       c.sent.Load(),
+		Delivered:  c.delivered.Load(),
+		Dropped:    c.dropped.Load(),
+		Duplicated: c.duplicated.Load(),
+	}
 }
 
 func (k kontext) NetworkOp() error {
 	// Fail the operation artificially for the given probability.
-	if biasedBoolean(k.conf.NetworkFailureProbability) {
+	if k.random.biasedBoolean(k.conf.NetworkFailureProbability) {
 		return fmt.Errorf("artificial network failure")
 	}
 
 	// Sleep as per the given delay configs.
-	time.Sleep(randomDurationBetween(k.conf.NetworkMinDelay, k.conf.NetworkMaxDelay))
-	return nil
+	return k.Sleep(k.networkDelay())
+}
+
+func (k kontext) NetworkOpTo(from, to NodeID) error {
+	return k.transmit(link{from: from, to: to})
+}
+
+func (k kontext) Deliver(from, to NodeID, handler func() (any, error)) (any, error) {
+	request, response := link{from: from, to: to}, link{from: to, to: from}
+
+	// The request travels to the receiving node.
+	if err := k.transmit(request); err != nil {
+		return nil, err
+	}
+
+	// The network may deliver the request once more, later.
+	k.duplicate(request, handler)
+
+	// The request is handled, and the response travels back.
+	result, err := handler()
+	if errNet := k.transmit(response); errNet != nil {
+		return nil, errNet
+	}
+
+	return result, err
+}
+
+func (k kontext) Concurrently(n int, call func(i int)) {
+	k.sched.join(n, call)
+}
+
+func (k kontext) NewID() string {
+	return k.random.id()
+}
+
+func (k kontext) Sleep(duration time.Duration) error {
+	// Let the simulated time pass.
+	return k.sched.sleep(k, duration)
 }
 
 func (k kontext) Time() time.Time {
-	// Add the specified offset to the current time.
-	return time.Now().Add(randomDurationBetween(0, k.conf.MaxClockOffset))
+	return k.TimeOf(k.node)
+}
+
+func (k kontext) TimeOf(node NodeID) time.Time {
+	// Read the node's clock at the current simulated time.
+	return k.clocks.read(node, k.sched.Now())
+}
+
+func (k kontext) Monotonic() time.Duration {
+	return k.MonotonicOf(k.node)
+}
+
+func (k kontext) MonotonicOf(node NodeID) time.Duration {
+	// Read the node's monotonic clock at the current simulated time.
+	return k.clocks.monotonic(node, k.sched.Now())
+}
+
+// onLink provides a copy of the context for messages over the given link.
+//
+// Messages over a link follow their own random decisions, which do not depend
+// on the order in which the concurrent messages were sent.
+func (k kontext) onLink(l link) kontext {
+	k.random = k.random.derive(l.key())
+	return k
+}
+
+// transmit simulates a message that travels over the given link, and counts it.
+func (k kontext) transmit(l link) error {
+	k.messages.sent.Add(1)
+	if err := k.travel(l); err != nil {
+		k.messages.dropped.Add(1)
+		return err
+	}
+
+	k.messages.delivered.Add(1)
+	return nil
+}
+
+// travel simulates the journey of a message over the given link.
+func (k kontext) travel(l link) error {
+	// The message cannot be sent over a faulty link.
+	if err := k.net.check(l); err != nil {
+		return err
+	}
+
+	if err := k.onLink(l).NetworkOp(); err != nil {
+		return err
+	}
+
+	// The link may have become faulty while the message was in flight.
+	return k.net.check(l)
+}
+
+// duplicate delivers a copy of a request over the given link later, as per the
+// duplication probability. The copy runs the handler again, like a stale message
+// replayed by the network would.
+func (k kontext) duplicate(l link, handler func() (any, error)) {
+	linkCtx := k.onLink(l)
+	if !linkCtx.random.biasedBoolean(k.conf.NetworkDuplicateProbability) {
+		return
+	}
+
+	delay := linkCtx.networkDelay()
+	k.sched.spawn(func() {
+		// The copy is lost if the simulation ends or the link fails meanwhile.
+		if k.Sleep(delay) != nil || k.net.check(l) != nil {
+			return
+		}
+		k.messages.duplicated.Add(1)
+		_, _ = handler()
+	})
+}
+
+// networkDelay provides a random delay for a message as per the config.
+//
+// Some messages are held back for longer, so that the messages sent after them
+// can overtake them. A latency set by the fault injection takes precedence
+// over the config.
+func (k kontext) networkDelay() time.Duration {
+	minDelay, maxDelay := k.conf.NetworkMinDelay, k.conf.NetworkMaxDelay
+	if latency := k.net.getLatency(); latency != nil {
+		minDelay, maxDelay = latency.min, latency.max
+	}
+
+	delay := k.random.durationBetween(minDelay, maxDelay)
+	if k.random.biasedBoolean(k.conf.NetworkReorderProbability) {
+		delay += k.random.durationBetween(0, k.conf.NetworkReorderWindow)
+	}
+	return delay
 }
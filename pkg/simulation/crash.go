@@ -0,0 +1,27 @@
+package simulation
+
+// startCrashes starts crashing random nodes, one at a time, as per the config,
+// using the given injector.
+//
+// Crashes keep coming until the injector is stopped, which also brings the
+// crashed node back up. It must be called by the goroutine that runs the scheduler.
+func startCrashes(in *injector) {
+	// Short hand for config.
+	conf := in.ctx.conf
+	// Crashes follow their own random decisions.
+	r := in.ctx.random.derive(crashRandomKey)
+
+	var crash func()
+
+	crash = func() {
+		node := NodeID(r.intn(in.NodeCount()))
+		in.Crash(node)
+
+		in.after(conf.CrashDuration, func() {
+			in.Restart(node, conf.CrashAmnesia)
+			in.after(conf.CrashInterval, crash)
+		})
+	}
+
+	in.after(conf.CrashInterval, crash)
+}
@@ -0,0 +1,389 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"contester/pkg/linearizability"
+)
+
+// OperationKind is the kind of an ExternalAPI call.
+type OperationKind string
+
+const (
+	// OperationGet represents an ExternalAPI.Get call.
+	OperationGet OperationKind = "get"
+	// OperationSet represents an ExternalAPI.Set call.
+	OperationSet OperationKind = "set"
+	// OperationCAS represents a CASExternalAPI.CompareAndSet call.
+	OperationCAS OperationKind = "cas"
+	// OperationTransaction represents a ListExternalAPI.Transact call.
+	OperationTransaction OperationKind = "txn"
+)
+
+// Operation is the record of a single ExternalAPI call made during a simulation.
+type Operation struct {
+	// Node is the index of the instance that received the call.
+	Node int
+	// Client is the ID of the simulated client that made the call.
+	Client int
+	// Key of the register that the call concerns. It is empty for the single
+	// register of an ExternalAPI.
+	Key string
+	// Kind of the call.
+	Kind OperationKind
+	// Input is the state passed to a Set or a CompareAndSet call. It is empty for a Get call.
+	Input string
+	// Expected is the expected state passed to a CompareAndSet call. It is empty for other calls.
+	Expected string
+	// Output is the state returned by a Get call. It is empty for other calls.
+	Output string
+	// Swapped is the result of a CompareAndSet call. It is false for other calls.
+	Swapped bool
+	// Transaction holds the micro-operations of a Transact call, with the results
+	// of the reads once it succeeded. It is empty for other calls.
+	Transaction []ListOp
+	// Error is the error returned by the call. It is empty if the call succeeded.
+	Error string
+
+	// Invoked is the simulated time of the invocation, relative to the start of the simulation.
+	Invoked time.Duration
+	// Completed is the simulated time of the completion, relative to the start of the simulation.
+	Completed time.Duration
+
+	// InvokeIndex is the position of the invocation among all recorded events.
+	InvokeIndex int64
+	// CompleteIndex is the position of the completion among all recorded events.
+	//
+	// Unlike the timestamps, the indexes never tie, so they give the exact
+	// real-time order of the events.
+	CompleteIndex int64
+}
+
+// Failed returns true if the call returned an error.
+func (o Operation) Failed() bool {
+	return o.Error != ""
+}
+
+// notMade returns true if the operation failed because its node was down, so its
+// call was never made and it certainly had no effect.
+func (o Operation) notMade() bool {
+	return o.Error == errNodeDown.Error()
+}
+
+// String formats the operation like `node 0, client 3: set "x" -> ok` or
+// `node 1, client 4: cas "x" to "y" -> true`, and transactions like
+// `node 2, client 5: txn [append key-0 3, r key-1 [1 2]] -> ok`.
+func (o Operation) String() string {
+	call := fmt.Sprintf("node %d, client %d: %s", o.Node, o.Client, o.Kind)
+	if o.Key != "" {
+		call += " " + o.Key
+	}
+	switch o.Kind {
+	case OperationSet:
+		call += fmt.Sprintf(" %q", o.Input)
+	case OperationCAS:
+		call += fmt.Sprintf(" %q to %q", o.Expected, o.Input)
+	case OperationTransaction:
+		call += " " + formatTransaction(o.Transaction)
+	}
+
+	switch {
+	case o.Failed():
+		// Joined errors span multiple lines.
+		return fmt.Sprintf("%s -> error: %s", call, strings.ReplaceAll(o.Error, "\n", "; "))
+	case o.Kind == OperationGet:
+		return fmt.Sprintf("%s -> %q", call, o.Output)
+	case o.Kind == OperationCAS:
+		return fmt.Sprintf("%s -> %t", call, o.Swapped)
+	default:
+		return call + " -> ok"
+	}
+}
+
+// FaultKind is the kind of a fault injected into a simulation.
+type FaultKind string
+
+const (
+	// FaultPartition represents the start of a network partition.
+	FaultPartition FaultKind = "partition"
+	// FaultHeal represents the end of a network partition.
+	FaultHeal FaultKind = "heal"
+	// FaultCrash represents a node going down.
+	FaultCrash FaultKind = "crash"
+	// FaultRestart represents a crashed node coming back up.
+	FaultRestart FaultKind = "restart"
+	// FaultClockJump represents a step of the clock of a node.
+	FaultClockJump FaultKind = "clock-jump"
+	// FaultLatency represents an override of the network delays.
+	FaultLatency FaultKind = "latency"
+	// FaultLatencyReset represents the end of an override of the network delays.
+	FaultLatencyReset FaultKind = "latency-reset"
+)
+
+// Fault is the record of a fault injected during a simulation.
+type Fault struct {
+	// Time is the simulated time of the fault, relative to the start of the simulation.
+	Time time.Duration
+	// Index is the position of the fault among all recorded events, like the
+	// indexes of an Operation.
+	Index int64
+	// Kind of the fault.
+	Kind FaultKind
+	// Nodes affected by the fault, for faults that concern specific nodes.
+	Nodes []NodeID
+	// Partition is the new layout of the network, for partition faults.
+	Partition *Partition
+	// Amount is the step of the clock, for clock jumps.
+	Amount time.Duration
+	// Amnesia is true if the node lost its in-memory state, for restarts.
+	Amnesia bool
+	// MinLatency and MaxLatency are the new network delays, for latency overrides.
+	MinLatency, MaxLatency time.Duration
+	// Description is a human readable summary of the fault.
+	Description string
+}
+
+// History of all ExternalAPI calls made, and faults injected, during a simulation.
+type History struct {
+	// Operations in the order of their invocation.
+	Operations []Operation
+	// Faults in the order of their injection.
+	Faults []Fault
+}
+
+// String formats the history as a timeline, with an operation or a fault on every line.
+func (h *History) String() string {
+	type line struct {
+		index int64
+		text  string
+	}
+
+	var lines []line
+	for _, op := range h.Operations {
+		text := fmt.Sprintf("[%s - %s] %s", op.Invoked, op.Completed, op)
+		lines = append(lines, line{index: op.InvokeIndex, text: text})
+	}
+	for _, fault := range h.Faults {
+		text := fmt.Sprintf("[%s] fault: %s", fault.Time, fault.Description)
+		lines = append(lines, line{index: fault.Index, text: text})
+	}
+
+	sort.Slice(lines, func(i, j int) bool { return lines[i].index < lines[j].index })
+
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// registerOperations converts the operations of the given key for the
+// compare-and-set register linearizability model, which is a superset of the
+// plain register model.
+//
+// Operations that cannot matter to the checker are left out. So, along with the
+// converted operations, it provides the index in the history of each of them.
+func (h *History) registerOperations(key string) ([]linearizability.Operation, []int) {
+	// Collect all values that were ever read, or that a compare-and-set expected,
+	// as the latter may only have succeeded because a failed write took effect.
+	observed := map[string]bool{}
+	// A compare-and-set that did not swap may only have failed because a failed
+	// write took effect, whatever its value. Then no failed write can be left out.
+	keepAll := false
+	for _, op := range h.Operations {
+		if op.Key != key || op.notMade() {
+			continue
+		}
+		switch {
+		case op.Kind == OperationGet && !op.Failed():
+			observed[op.Output] = true
+		case op.Kind == OperationCAS:
+			observed[op.Expected] = true
+			keepAll = keepAll || (!op.Failed() && !op.Swapped)
+		}
+	}
+
+	ops := make([]linearizability.Operation, 0, len(h.Operations))
+	indexes := make([]int, 0, len(h.Operations))
+	for i, op := range h.Operations {
+		// Every key is checked on its own.
+		if op.Key != key {
+			continue
+		}
+		// A call that was never made had no effect, so it can be left out.
+		if op.notMade() {
+			continue
+		}
+
+		converted := linearizability.Operation{
+			Call:   op.InvokeIndex,
+			Return: op.CompleteIndex,
+		}
+
+		switch op.Kind {
+		case OperationGet:
+			// A failed read has no effect, so it can be left out.
+			if op.Failed() {
+				continue
+			}
+			converted.Input = linearizability.RegisterInput{Write: false}
+			converted.Output = op.Output
+		case OperationSet:
+			converted.Input = linearizability.RegisterInput{Write: true, Value: op.Input}
+			// The outcome of a failed write is unknown. It may take effect at any
+			// point after its invocation, or never.
+			if op.Failed() {
+				// If its value was never observed, it might as well have never happened.
+				// Leaving it out keeps the search space of the checker small.
+				if !keepAll && !observed[op.Input] {
+					continue
+				}
+				converted.Return = math.MaxInt64
+			}
+		case OperationCAS:
+			converted.Input = linearizability.CompareAndSetInput{Expected: op.Expected, Value: op.Input}
+			converted.Output = op.Swapped
+			// A failed compare-and-set is like a failed write, with an unknown
+			// outcome on top.
+			if op.Failed() {
+				if !keepAll && !observed[op.Input] {
+					continue
+				}
+				converted.Output = nil
+				converted.Return = math.MaxInt64
+			}
+		}
+
+		ops = append(ops, converted)
+		indexes = append(indexes, i)
+	}
+
+	return ops, indexes
+}
+
+// recorder builds a History. It is safe for concurrent use.
+type recorder struct {
+	// clock provides the simulated time, relative to the start of the simulation.
+	clock func() time.Duration
+	// timeline orders all invocations and completions.
+	timeline eventCounter
+
+	history      History
+	historyMutex *sync.Mutex
+}
+
+// newRecorder creates a new recorder that reads time from the given clock.
+func newRecorder(clock func() time.Duration) *recorder {
+	return &recorder{
+		clock:        clock,
+		historyMutex: &sync.Mutex{},
+	}
+}
+
+// invoke records the invocation of a call and returns its ID for the completion.
+func (r *recorder) invoke(node, client int, key string, kind OperationKind, input string) int {
+	op := Operation{
+		Node:        node,
+		Client:      client,
+		Key:         key,
+		Kind:        kind,
+		Input:       input,
+		Invoked:     r.clock(),
+		InvokeIndex: r.timeline.next(),
+	}
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	r.history.Operations = append(r.history.Operations, op)
+	return len(r.history.Operations) - 1
+}
+
+// invokeCompareAndSet records the invocation of a CompareAndSet call and returns
+// its ID for the completion.
+func (r *recorder) invokeCompareAndSet(node, client int, expected, input string) int {
+	id := r.invoke(node, client, "", OperationCAS, input)
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	r.history.Operations[id].Expected = expected
+	return id
+}
+
+// invokeTransaction records the invocation of a Transact call and returns its ID
+// for the completion.
+func (r *recorder) invokeTransaction(node, client int, txn []ListOp) int {
+	id := r.invoke(node, client, "", OperationTransaction, "")
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	// The instance may fill in the given micro-operations, which must not change the history.
+	r.history.Operations[id].Transaction = append([]ListOp(nil), txn...)
+	return id
+}
+
+// complete records the completion of the call with the given ID.
+func (r *recorder) complete(id int, output string, err error) {
+	r.completeWith(id, err, func(op *Operation) { op.Output = output })
+}
+
+// completeCompareAndSet records the completion of the CompareAndSet call with the given ID.
+func (r *recorder) completeCompareAndSet(id int, swapped bool, err error) {
+	r.completeWith(id, err, func(op *Operation) { op.Swapped = swapped })
+}
+
+// completeTransaction records the completion of the Transact call with the given
+// ID. The result replaces the requested micro-operations, if the call succeeded.
+func (r *recorder) completeTransaction(id int, result []ListOp, err error) {
+	r.completeWith(id, err, func(op *Operation) {
+		if err == nil {
+			op.Transaction = result
+		}
+	})
+}
+
+// completeWith records the completion of the call with the given ID, with its
+// result set by the given function.
+func (r *recorder) completeWith(id int, err error, setResult func(op *Operation)) {
+	completed, completeIndex := r.clock(), r.timeline.next()
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	op := &r.history.Operations[id]
+	setResult(op)
+	op.Completed = completed
+	op.CompleteIndex = completeIndex
+	if err != nil {
+		op.Error = err.Error()
+	}
+}
+
+// fault records the given fault as happening now.
+func (r *recorder) fault(fault Fault) {
+	fault.Time, fault.Index = r.clock(), r.timeline.next()
+
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	r.history.Faults = append(r.history.Faults, fault)
+}
+
+// snapshot provides a copy of the history recorded so far.
+func (r *recorder) snapshot() *History {
+	r.historyMutex.Lock()
+	defer r.historyMutex.Unlock()
+
+	ops := make([]Operation, len(r.history.Operations))
+	copy(ops, r.history.Operations)
+	faults := make([]Fault, len(r.history.Faults))
+	copy(faults, r.history.Faults)
+	return &History{Operations: ops, Faults: faults}
+}
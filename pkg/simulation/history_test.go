@@ -0,0 +1,156 @@
+package simulation
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"contester/pkg/linearizability"
+)
+
+// sequential numbers the invocations and completions of the given operations in their
+// order, as if every operation completed before the next one was invoked. Failed
+// operations keep their positions, as their outcome is unknown anyway.
+func sequential(ops ...Operation) *History {
+	for i := range ops {
+		ops[i].InvokeIndex = int64(2 * i)
+		ops[i].CompleteIndex = int64(2*i + 1)
+	}
+	return &History{Operations: ops}
+}
+
+func TestRegisterOperationsPruning(t *testing.T) {
+	const failure = "artificial network failure"
+
+	tests := []struct {
+		name    string
+		history *History
+		// kept holds the history indexes of the operations that must be kept.
+		kept []int
+		// unknown holds the history indexes of the kept operations with an unknown outcome.
+		unknown []int
+		ok      bool
+	}{
+		{
+			name: "failed read is left out",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationGet, Error: failure},
+				Operation{Kind: OperationGet, Output: "x"},
+			),
+			kept: []int{0, 2},
+			ok:   true,
+		},
+		{
+			name: "failed write that was never read is left out",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationSet, Input: "y", Error: failure},
+				Operation{Kind: OperationGet, Output: "x"},
+			),
+			kept: []int{0, 2},
+			ok:   true,
+		},
+		{
+			name: "failed write that was read is kept",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "y", Error: failure},
+				Operation{Kind: OperationGet, Output: "y"},
+			),
+			kept:    []int{0, 1},
+			unknown: []int{0},
+			ok:      true,
+		},
+		{
+			name: "failed write that a compare-and-set expected is kept",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "y", Error: failure},
+				Operation{Kind: OperationCAS, Expected: "y", Input: "z", Swapped: true},
+				Operation{Kind: OperationGet, Output: "z"},
+			),
+			kept:    []int{0, 1, 2},
+			unknown: []int{0},
+			ok:      true,
+		},
+		{
+			name: "failed write is kept if a compare-and-set did not swap",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationSet, Input: "y", Error: failure},
+				Operation{Kind: OperationCAS, Expected: "x", Input: "z"},
+			),
+			kept:    []int{0, 1, 2},
+			unknown: []int{1},
+			ok:      true,
+		},
+		{
+			name: "failed compare-and-set that was read is kept",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationCAS, Expected: "x", Input: "z", Error: failure},
+				Operation{Kind: OperationGet, Output: "z"},
+			),
+			kept:    []int{0, 1, 2},
+			unknown: []int{1},
+			ok:      true,
+		},
+		{
+			// The value of a write that was never made cannot be read, even if a
+			// compare-and-set did not swap.
+			name: "write to a crashed node is left out",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationSet, Input: "y", Error: errNodeDown.Error()},
+				Operation{Kind: OperationCAS, Expected: "y", Input: "z", Error: errNodeDown.Error()},
+				Operation{Kind: OperationCAS, Expected: "y", Input: "z"},
+				Operation{Kind: OperationGet, Output: "y"},
+			),
+			kept: []int{0, 3, 4},
+			ok:   false,
+		},
+		{
+			name: "operations on other keys are left out",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationSet, Key: "other", Input: "y"},
+				Operation{Kind: OperationGet, Key: "other", Output: "y"},
+				Operation{Kind: OperationGet, Output: "x"},
+			),
+			kept: []int{0, 3},
+			ok:   true,
+		},
+		{
+			name: "stale read is still caught",
+			history: sequential(
+				Operation{Kind: OperationSet, Input: "x"},
+				Operation{Kind: OperationSet, Input: "y"},
+				Operation{Kind: OperationGet, Output: "x"},
+			),
+			kept: []int{0, 1, 2},
+			ok:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops, indexes := test.history.registerOperations("")
+			if !reflect.DeepEqual(indexes, test.kept) {
+				t.Fatalf("registerOperations() kept %v, want %v", indexes, test.kept)
+			}
+
+			unknown := map[int]bool{}
+			for _, index := range test.unknown {
+				unknown[index] = true
+			}
+			for n, op := range ops {
+				if got := op.Return == math.MaxInt64; got != unknown[indexes[n]] {
+					t.Errorf("operation %d has an unknown outcome: %t, want %t", indexes[n], got, unknown[indexes[n]])
+				}
+			}
+
+			if result := linearizability.Check(linearizability.CASRegisterModel, ops); result.Ok != test.ok {
+				t.Errorf("Check() ok = %t, want %t", result.Ok, test.ok)
+			}
+		})
+	}
+}
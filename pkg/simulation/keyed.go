@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"fmt"
+)
+
+// KeyedExternalAPI is an ExternalAPI that stores many independent registers,
+// each identified by a key.
+//
+// If the Config asks for more than one key, every instance must implement it,
+// and the requests are spread across the keys. Every key must behave like a
+// linearizable register on its own, and it is checked independently.
+type KeyedExternalAPI interface {
+	ExternalAPI
+	// GetKey provides the current state of the given key and an error if
+	// something goes wrong.
+	GetKey(ctx Context, key string) (state string, err error)
+	// SetKey sets the state of the given key, and returns an error if
+	// something goes wrong.
+	SetKey(ctx Context, key string, state string) (err error)
+}
+
+// workloadKeys provides the keys of the workload as per the config.
+//
+// A workload of a single key uses the empty key, which stands for the single
+// register of the ExternalAPI.
+func workloadKeys(conf Config) []string {
+	if conf.KeyCount <= 1 {
+		return []string{""}
+	}
+
+	keys := make([]string, conf.KeyCount)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+// validateInstances checks that the instances support the workload of the config.
+func validateInstances(conf Config, instances []ExternalAPI) error {
+	if len(instances) == 0 {
+		return fmt.Errorf("at least one instance is required")
+	}
+
+	// Lists have their own API, which does not need the others.
+	if conf.Workload == WorkloadListAppend {
+		return validateListInstances(instances)
+	}
+
+	if conf.KeyCount > 1 {
+		for i, instance := range instances {
+			if _, ok := instance.(KeyedExternalAPI); !ok {
+				return fmt.Errorf("instance %d does not implement KeyedExternalAPI, which is required for a key count > 1", i)
+			}
+		}
+	}
+
+	return validateCASInstances(conf, instances)
+}
+
+// get calls the Get method of the instance for the given key. The empty key
+// stands for the single register of the ExternalAPI.
+func get(ctx Context, instance ExternalAPI, key string) (string, error) {
+	if key == "" {
+		return instance.Get(ctx)
+	}
+	return instance.(KeyedExternalAPI).GetKey(ctx, key)
+}
+
+// set calls the Set method of the instance for the given key. The empty key
+// stands for the single register of the ExternalAPI.
+func set(ctx Context, instance ExternalAPI, key string, state string) error {
+	if key == "" {
+		return instance.Set(ctx, state)
+	}
+	return instance.(KeyedExternalAPI).SetKey(ctx, key, state)
+}
@@ -0,0 +1,181 @@
+package simulation
+
+import (
+	"fmt"
+	"strings"
+
+	"contester/pkg/elle"
+)
+
+// Workload is the kind of requests that a simulation sends.
+type Workload string
+
+const (
+	// WorkloadRegister reads and writes registers, and checks them for linearizability.
+	WorkloadRegister Workload = "register"
+	// WorkloadListAppend runs transactions that append to and read lists, like
+	// Jepsen's list-append workload, and checks them for isolation anomalies.
+	WorkloadListAppend Workload = "list-append"
+)
+
+// Workloads holds all workloads that the simulation supports.
+var Workloads = []Workload{WorkloadRegister, WorkloadListAppend}
+
+// validate the workload. The empty workload stands for the register workload.
+func (w Workload) validate() error {
+	if w == "" {
+		return nil
+	}
+
+	for _, workload := range Workloads {
+		if w == workload {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown workload %q", w)
+}
+
+// ListOpKind is the kind of a micro-operation of a transaction.
+type ListOpKind string
+
+const (
+	// ListAppend appends a value to the list of a key.
+	ListAppend ListOpKind = "append"
+	// ListRead reads the list of a key.
+	ListRead ListOpKind = "r"
+)
+
+// ListOp is a micro-operation of a transaction of the list-append workload.
+type ListOp struct {
+	Kind ListOpKind
+	// Key of the list.
+	Key string
+	// Value to append. Every value is appended to a key only once.
+	Value int
+	// List is the result of a read, filled by ListExternalAPI.Transact.
+	List []int
+}
+
+// String formats the micro-operation like `append key-0 3` or `r key-1 [1 2 3]`.
+func (o ListOp) String() string {
+	if o.Kind == ListAppend {
+		return fmt.Sprintf("append %s %d", o.Key, o.Value)
+	}
+	if o.List == nil {
+		return fmt.Sprintf("r %s", o.Key)
+	}
+	return fmt.Sprintf("r %s %v", o.Key, o.List)
+}
+
+// ListExternalAPI is an ExternalAPI that stores lists of values, each identified
+// by a key, and runs transactions over them.
+//
+// If the Config asks for the list-append workload, every instance must implement
+// it. The transactions must be strictly serializable: every one of them must seem
+// to take effect at once, at some point between its invocation and its completion.
+type ListExternalAPI interface {
+	ExternalAPI
+	// Transact runs the given micro-operations as a single transaction, in order.
+	// It provides them back with the results of the reads filled in, and returns
+	// an error if something goes wrong.
+	//
+	// A call that returns an error may or may not have taken effect.
+	Transact(ctx Context, txn []ListOp) (result []ListOp, err error)
+}
+
+// validateListInstances checks that the instances support the list-append workload.
+func validateListInstances(instances []ExternalAPI) error {
+	for i, instance := range instances {
+		if _, ok := instance.(ListExternalAPI); !ok {
+			return fmt.Errorf("instance %d does not implement ListExternalAPI, which is required for the %s workload", i, WorkloadListAppend)
+		}
+	}
+	return nil
+}
+
+// listKeys provides the keys of the lists of the list-append workload. Unlike
+// the register workload, it always names its keys, even if there is a single one.
+func listKeys(conf Config) []string {
+	keys := make([]string, 1)
+	if conf.KeyCount > 1 {
+		keys = make([]string, conf.KeyCount)
+	}
+
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+// newTransaction generates a random transaction of the list-append workload. Its
+// length and its micro-operations are chosen as per the config.
+//
+// Appended values count up per key, using the given counters, so that they are unique.
+func newTransaction(r *random, conf Config, keys []string, counters map[string]int) []ListOp {
+	length := 1
+	if conf.MaxTransactionLength > 1 {
+		length += r.intn(conf.MaxTransactionLength)
+	}
+
+	txn := make([]ListOp, length)
+	for i := range txn {
+		key := keys[r.intn(len(keys))]
+		if r.biasedBoolean(conf.ReadRatio) {
+			txn[i] = ListOp{Kind: ListRead, Key: key}
+			continue
+		}
+
+		counters[key]++
+		txn[i] = ListOp{Kind: ListAppend, Key: key, Value: counters[key]}
+	}
+
+	return txn
+}
+
+// transact calls the Transact method of the instance.
+func transact(ctx Context, instance ExternalAPI, txn []ListOp) ([]ListOp, error) {
+	return instance.(ListExternalAPI).Transact(ctx, txn)
+}
+
+// formatTransaction formats the given micro-operations like `[append key-0 3, r key-1]`.
+func formatTransaction(txn []ListOp) string {
+	texts := make([]string, len(txn))
+	for i, op := range txn {
+		texts[i] = op.String()
+	}
+	return "[" + strings.Join(texts, ", ") + "]"
+}
+
+// listTransactions converts the transactions of the history for the elle checker.
+// The ID of every transaction is its index in the history.
+func (h *History) listTransactions() []elle.Transaction {
+	var txns []elle.Transaction
+
+	for i, op := range h.Operations {
+		if op.Kind != OperationTransaction {
+			continue
+		}
+
+		txn := elle.Transaction{ID: i, Status: elle.StatusOk, Call: op.InvokeIndex, Return: op.CompleteIndex}
+		switch {
+		// A call that was never made certainly had no effect.
+		case op.notMade():
+			txn.Status = elle.StatusFailed
+		// Otherwise, the outcome of a failed call is unknown.
+		case op.Failed():
+			txn.Status = elle.StatusUnknown
+		}
+
+		for _, listOp := range op.Transaction {
+			micro := elle.MicroOp{Kind: elle.Read, Key: listOp.Key, List: listOp.List}
+			if listOp.Kind == ListAppend {
+				micro = elle.MicroOp{Kind: elle.Append, Key: listOp.Key, Value: listOp.Value}
+			}
+			txn.Ops = append(txn.Ops, micro)
+		}
+
+		txns = append(txns, txn)
+	}
+
+	return txns
+}
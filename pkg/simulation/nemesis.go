@@ -0,0 +1,258 @@
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Nemesis injects faults into a simulation as per its own timeline.
+//
+// The random faults of the Config cover the common cases. A Nemesis allows
+// a test to declare exactly which fault happens when. See the nemesis package
+// for an implementation based on a simple schedule language.
+type Nemesis interface {
+	// Start is called once, at the start of the simulation. It should schedule
+	// all its faults using the given Faults, and return an error if it cannot.
+	Start(faults Faults) error
+}
+
+// Faults allows a Nemesis to inject faults into a running simulation.
+//
+// Its methods must only be called during Nemesis.Start, or from functions
+// that were scheduled using the At method. All faults end with the requests,
+// so that the final read of the simulation happens in a healthy system.
+// Faults on nodes that do not exist are ignored.
+type Faults interface {
+	// NodeCount provides the number of nodes in the simulation.
+	NodeCount() int
+	// At schedules the given function at the given simulated time, relative
+	// to the start of the simulation. A time that has passed already schedules
+	// it right away.
+	At(at time.Duration, fn func())
+
+	// Partition splits the network into the given groups of nodes. Nodes can
+	// only reach the nodes that share a group with them.
+	Partition(groups [][]NodeID)
+	// PartitionRandom partitions the network randomly with the given kind.
+	PartitionRandom(kind PartitionKind)
+	// Heal ends any partition of the network.
+	Heal()
+
+	// Crash makes all operations on the given node fail, until it is restarted.
+	Crash(node NodeID)
+	// Restart brings a crashed node back up. With amnesia, the node loses its
+	// in-memory state, if its instance implements the Restartable interface.
+	Restart(node NodeID, amnesia bool)
+
+	// JumpClock steps the clock of the given node by the given amount.
+	JumpClock(node NodeID, amount time.Duration)
+
+	// SetLatency overrides the delays of all network operations.
+	SetLatency(min, max time.Duration)
+	// ResetLatency restores the network delays of the Config.
+	ResetLatency()
+}
+
+// injector implements the Faults interface for a simulation session, and
+// records every injected fault.
+//
+// It is used by the random faults of the Config and by the Nemesis alike.
+// All of its methods must be called by the goroutine that runs the scheduler.
+type injector struct {
+	ctx       kontext
+	instances []ExternalAPI
+	rec       *recorder
+	// random is used for the random decisions of the fault injection.
+	random *random
+
+	// stopped is true once the faults have ended.
+	stopped bool
+	// partitioned is true while there is a partition.
+	partitioned bool
+	// crashed holds the nodes that are currently down.
+	crashed map[NodeID]bool
+}
+
+// newInjector creates a new injector for the given session.
+func newInjector(ctx kontext, instances []ExternalAPI, rec *recorder) *injector {
+	return &injector{
+		ctx:       ctx,
+		instances: instances,
+		rec:       rec,
+		random:    ctx.random.derive(nemesisRandomKey),
+		crashed:   map[NodeID]bool{},
+	}
+}
+
+func (in *injector) NodeCount() int {
+	return len(in.instances)
+}
+
+func (in *injector) At(at time.Duration, fn func()) {
+	// A time that has passed already means right away.
+	delay := at - in.ctx.sched.Now()
+	if delay < 0 {
+		delay = 0
+	}
+	in.after(delay, fn)
+}
+
+func (in *injector) Partition(groups [][]NodeID) {
+	// Nodes that do not exist cannot be cut off.
+	var known [][]NodeID
+	for _, group := range groups {
+		var nodes []NodeID
+		for _, node := range group {
+			if in.exists(node) {
+				nodes = append(nodes, node)
+			}
+		}
+		known = append(known, nodes)
+	}
+	groups = known
+
+	in.partition(partitionFromGroups(PartitionCustom, len(in.instances), groups))
+}
+
+func (in *injector) PartitionRandom(kind PartitionKind) {
+	in.partition(newPartition(kind, len(in.instances), in.random))
+}
+
+func (in *injector) Heal() {
+	// Nothing to heal.
+	if !in.partitioned {
+		return
+	}
+
+	in.ctx.net.setPartition(nil)
+	in.partitioned = false
+
+	in.rec.fault(Fault{Kind: FaultHeal, Description: "network healed"})
+}
+
+func (in *injector) Crash(node NodeID) {
+	// Already down, or not there at all.
+	if !in.exists(node) || in.crashed[node] {
+		return
+	}
+
+	in.ctx.net.setCrashed(node, true)
+	in.crashed[node] = true
+
+	in.rec.fault(Fault{
+		Kind:        FaultCrash,
+		Nodes:       []NodeID{node},
+		Description: fmt.Sprintf("node %d crashed", node),
+	})
+}
+
+func (in *injector) Restart(node NodeID, amnesia bool) {
+	// Already up, or not there at all.
+	if !in.exists(node) || !in.crashed[node] {
+		return
+	}
+
+	fault := Fault{
+		Kind:        FaultRestart,
+		Nodes:       []NodeID{node},
+		Description: fmt.Sprintf("node %d restarted", node),
+	}
+	// A node with amnesia comes back without its in-memory state. It drops the
+	// state before it is up, so no call reaches it in between. No task runs while
+	// the scheduler injects faults, so none holds the node's locks either.
+	if restartable, ok := in.instances[node].(Restartable); ok && amnesia {
+		fault.Amnesia = true
+		fault.Description += " with amnesia"
+		restartable.Restart()
+	}
+
+	in.ctx.net.setCrashed(node, false)
+	delete(in.crashed, node)
+
+	in.rec.fault(fault)
+}
+
+func (in *injector) JumpClock(node NodeID, amount time.Duration) {
+	if !in.exists(node) {
+		return
+	}
+
+	in.ctx.clocks.step(node, amount)
+
+	in.rec.fault(Fault{
+		Kind:        FaultClockJump,
+		Nodes:       []NodeID{node},
+		Amount:      amount,
+		Description: fmt.Sprintf("clock of node %d jumped by %s", node, amount),
+	})
+}
+
+func (in *injector) SetLatency(min, max time.Duration) {
+	in.ctx.net.setLatency(&latency{min: min, max: max})
+
+	in.rec.fault(Fault{
+		Kind:        FaultLatency,
+		MinLatency:  min,
+		MaxLatency:  max,
+		Description: fmt.Sprintf("network latency set to %s..%s", min, max),
+	})
+}
+
+func (in *injector) ResetLatency() {
+	// Nothing to reset.
+	if in.ctx.net.getLatency() == nil {
+		return
+	}
+
+	in.ctx.net.setLatency(nil)
+
+	in.rec.fault(Fault{Kind: FaultLatencyReset, Description: "network latency reset"})
+}
+
+// exists returns true if the given node is part of the simulation.
+func (in *injector) exists(node NodeID) bool {
+	return node >= 0 && int(node) < len(in.instances)
+}
+
+// after schedules the given function after the given simulated duration.
+// The function is skipped if the faults have ended by then.
+func (in *injector) after(duration time.Duration, fn func()) {
+	in.ctx.sched.schedule(duration, func() {
+		if !in.stopped {
+			fn()
+		}
+	})
+}
+
+// partition the network as per the given layout.
+func (in *injector) partition(layout *Partition) {
+	in.ctx.net.setPartition(layout)
+	in.partitioned = true
+
+	in.rec.fault(Fault{
+		Kind:        FaultPartition,
+		Partition:   layout,
+		Description: fmt.Sprintf("%s partition %s", layout.Kind, layout),
+	})
+}
+
+// stop ends all faults, and brings the system back to health. Crashed nodes are
+// restarted with the given amnesia. Clock jumps are permanent, like in reality.
+func (in *injector) stop(amnesia bool) {
+	in.Heal()
+	in.ResetLatency()
+
+	// Restart the crashed nodes in order, for the sake of reproducibility.
+	var crashed []NodeID
+	for node := range in.crashed {
+		crashed = append(crashed, node)
+	}
+
+	sort.Slice(crashed, func(i, j int) bool { return crashed[i] < crashed[j] })
+	for _, node := range crashed {
+		in.Restart(node, amnesia)
+	}
+
+	in.stopped = true
+}
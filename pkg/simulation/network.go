@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// errPartitioned is returned for network operations over a partitioned link.
+	errPartitioned = errors.New("artificial network partition")
+	// errCrashed is returned for operations that involve a crashed node.
+	errCrashed = errors.New("artificial node crash")
+	// errNodeDown is recorded for calls to a crashed node, which are never made.
+	// Unlike errCrashed, it certainly means that the call had no effect.
+	errNodeDown = errors.New("artificial node crash, call not made")
+)
+
+// NodeID identifies a node of the simulated system.
+//
+// The instance at index i of the slice passed to Run is the node with ID i.
+type NodeID int
+
+// link is a one-way network connection between two nodes.
+type link struct {
+	from, to NodeID
+}
+
+// key provides a unique number for the link, usable as a random source key.
+func (l link) key() int64 {
+	return int64(l.from)<<32 | int64(uint32(l.to))
+}
+
+// network holds the state of the simulated network that is shared by all nodes.
+// It is safe for concurrent use.
+type network struct {
+	// partition is the current partition of the network, nil if there is none.
+	partition *Partition
+	// crashed holds the nodes that are currently down.
+	crashed map[NodeID]bool
+	// latency overrides the network delays of the config, nil if there is no override.
+	latency    *latency
+	stateMutex *sync.RWMutex
+}
+
+// latency is a range of network delays.
+type latency struct {
+	min, max time.Duration
+}
+
+// newNetwork creates a new network without any faults.
+func newNetwork() *network {
+	return &network{
+		crashed:    map[NodeID]bool{},
+		stateMutex: &sync.RWMutex{},
+	}
+}
+
+// check returns an error if a message cannot currently travel over the given link.
+func (n *network) check(l link) error {
+	n.stateMutex.RLock()
+	defer n.stateMutex.RUnlock()
+
+	if n.crashed[l.from] || n.crashed[l.to] {
+		return errCrashed
+	}
+	if n.partition != nil && !n.partition.reachable(l.from, l.to) {
+		return errPartitioned
+	}
+	return nil
+}
+
+// isUp returns false if the given node is crashed.
+func (n *network) isUp(node NodeID) bool {
+	n.stateMutex.RLock()
+	defer n.stateMutex.RUnlock()
+
+	return !n.crashed[node]
+}
+
+// setPartition replaces the current partition. A nil partition heals the network.
+func (n *network) setPartition(partition *Partition) {
+	n.stateMutex.Lock()
+	defer n.stateMutex.Unlock()
+
+	n.partition = partition
+}
+
+// setCrashed marks the given node as crashed or up.
+func (n *network) setCrashed(node NodeID, crashed bool) {
+	n.stateMutex.Lock()
+	defer n.stateMutex.Unlock()
+
+	if crashed {
+		n.crashed[node] = true
+	} else {
+		delete(n.crashed, node)
+	}
+}
+
+// setLatency overrides the network delays of the config. A nil latency removes the override.
+func (n *network) setLatency(latency *latency) {
+	n.stateMutex.Lock()
+	defer n.stateMutex.Unlock()
+
+	n.latency = latency
+}
+
+// getLatency provides the current override of the network delays, nil if there is none.
+func (n *network) getLatency() *latency {
+	n.stateMutex.RLock()
+	defer n.stateMutex.RUnlock()
+
+	return n.latency
+}
@@ -0,0 +1,232 @@
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PartitionKind is the kind of a network partition.
+type PartitionKind string
+
+const (
+	// PartitionHalves splits the nodes randomly into a minority and a majority.
+	PartitionHalves PartitionKind = "halves"
+	// PartitionIsolate cuts a random node off from all the others.
+	PartitionIsolate PartitionKind = "isolate"
+	// PartitionBridge splits the nodes into two halves that are connected only
+	// through a single bridge node, which can reach everyone.
+	PartitionBridge PartitionKind = "bridge"
+	// PartitionRing places the nodes randomly on a ring, where every node can
+	// reach only its nearest neighbours. Every node sees a majority, but no two
+	// neighbours see the same majority.
+	PartitionRing PartitionKind = "ring"
+
+	// PartitionCustom is the kind of the partitions whose groups are given
+	// explicitly, by a Nemesis. It cannot be picked at random.
+	PartitionCustom PartitionKind = "custom"
+)
+
+// PartitionKinds lists all supported partition kinds.
+var PartitionKinds = []PartitionKind{PartitionHalves, PartitionIsolate, PartitionBridge, PartitionRing}
+
+// validate the partition kind.
+func (p PartitionKind) validate() error {
+	for _, kind := range PartitionKinds {
+		if p == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown partition kind: %s", p)
+}
+
+// Partition is a layout of the network in which some nodes cannot reach others.
+type Partition struct {
+	// Kind of the partition.
+	Kind PartitionKind
+	// Views holds, for every node, the sorted IDs of the nodes that it can reach,
+	// including itself. Reachability is always symmetric.
+	Views [][]NodeID
+}
+
+// reachable returns true if the partition allows messages from one node to the other.
+func (p *Partition) reachable(from, to NodeID) bool {
+	// A node can always talk to itself.
+	if from == to {
+		return true
+	}
+
+	// Nodes that are unknown to the partition are not affected by it.
+	if int(from) >= len(p.Views) || int(to) >= len(p.Views) {
+		return true
+	}
+
+	for _, node := range p.Views[from] {
+		if node == to {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the layout of the partition.
+//
+// A partition made of disjoint groups is formatted as "{0,1}|{2,3,4}". Any
+// other partition lists the view of every node, like "0:{0,1,4} 1:{0,1,2}".
+func (p *Partition) String() string {
+	if p.grouped() {
+		var groups []string
+		for _, group := range p.Groups() {
+			groups = append(groups, formatNodes(group))
+		}
+		return strings.Join(groups, "|")
+	}
+
+	views := make([]string, len(p.Views))
+	for node, view := range p.Views {
+		views[node] = fmt.Sprintf("%d:%s", node, formatNodes(view))
+	}
+	return strings.Join(views, " ")
+}
+
+// Groups provides groups of nodes that describe the partition exactly, such that
+// two nodes can reach each other only if they share a group.
+//
+// A partition made of disjoint groups provides those groups. Any other partition
+// provides a pair for every two nodes that can reach each other.
+func (p *Partition) Groups() [][]NodeID {
+	var groups [][]NodeID
+	grouped := p.grouped()
+	seen := map[string]bool{}
+
+	for node, view := range p.Views {
+		if grouped {
+			if group := formatNodes(view); !seen[group] {
+				seen[group] = true
+				groups = append(groups, view)
+			}
+			continue
+		}
+
+		for _, peer := range view {
+			if peer > NodeID(node) {
+				groups = append(groups, []NodeID{NodeID(node), peer})
+			}
+		}
+	}
+
+	return groups
+}
+
+// grouped returns true if the views of the partition form disjoint groups, which
+// is the case when all the nodes in a view have the very same view.
+func (p *Partition) grouped() bool {
+	for node, view := range p.Views {
+		for _, peer := range view {
+			if formatNodes(p.Views[peer]) != formatNodes(p.Views[node]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newPartition creates a random partition of the given kind over the given number of nodes.
+func newPartition(kind PartitionKind, nodeCount int, r *random) *Partition {
+	// Every partition kind starts with the nodes in a random order.
+	nodes := r.permutation(nodeCount)
+	// Sets of nodes that can reach each other completely.
+	var groups [][]NodeID
+
+	switch kind {
+	case PartitionHalves:
+		minority := nodeCount / 2
+		groups = [][]NodeID{nodes[:minority], nodes[minority:]}
+	case PartitionIsolate:
+		groups = [][]NodeID{nodes[:1], nodes[1:]}
+	case PartitionBridge:
+		// The first node is the bridge, and it belongs to both halves.
+		bridge, rest := nodes[0], nodes[1:]
+		half := len(rest) / 2
+		groups = [][]NodeID{
+			append([]NodeID{bridge}, rest[:half]...),
+			append([]NodeID{bridge}, rest[half:]...),
+		}
+	case PartitionRing:
+		// Every node forms a pair with each of its nearest neighbours on both
+		// sides. Pairs, unlike larger groups, do not let a node see the
+		// neighbours of its neighbours. The reach is chosen so that every node
+		// sees a majority.
+		majority := nodeCount/2 + 1
+		reach := majority / 2
+		for i := range nodes {
+			for distance := 1; distance <= reach; distance++ {
+				groups = append(groups, []NodeID{nodes[i], nodes[(i+distance)%nodeCount]})
+			}
+		}
+	}
+
+	return partitionFromGroups(kind, nodeCount, groups)
+}
+
+// partitionFromGroups creates a partition in which two nodes can reach each
+// other only if they share a group.
+func partitionFromGroups(kind PartitionKind, nodeCount int, groups [][]NodeID) *Partition {
+	visible := make([]map[NodeID]bool, nodeCount)
+	for node := range visible {
+		visible[node] = map[NodeID]bool{NodeID(node): true}
+	}
+
+	for _, group := range groups {
+		for _, a := range group {
+			for _, b := range group {
+				visible[a][b] = true
+			}
+		}
+	}
+
+	views := make([][]NodeID, nodeCount)
+	for node, peers := range visible {
+		for peer := range peers {
+			views[node] = append(views[node], peer)
+		}
+		sort.Slice(views[node], func(i, j int) bool { return views[node][i] < views[node][j] })
+	}
+
+	return &Partition{Kind: kind, Views: views}
+}
+
+// formatNodes formats a list of node IDs like "{0,1,2}".
+func formatNodes(nodes []NodeID) string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = fmt.Sprint(int(node))
+	}
+	return "{" + strings.Join(ids, ",") + "}"
+}
+
+// startPartitions starts injecting random partitions into the network as per
+// the config, using the given injector.
+//
+// Partitions keep coming until the injector is stopped, which also heals the
+// network. It must be called by the goroutine that runs the scheduler.
+func startPartitions(in *injector) {
+	// Short hand for config.
+	conf := in.ctx.conf
+	// Partitions follow their own random decisions.
+	r := in.ctx.random.derive(partitionRandomKey)
+
+	var partition, heal func()
+
+	partition = func() {
+		in.partition(newPartition(pick(r, conf.PartitionKinds), in.NodeCount(), r))
+		in.after(conf.PartitionDuration, heal)
+	}
+
+	heal = func() {
+		in.Heal()
+		in.after(conf.PartitionInterval, partition)
+	}
+
+	in.after(conf.PartitionInterval, partition)
+}
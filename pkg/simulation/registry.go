@@ -0,0 +1,70 @@
+package simulation
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ClusterFactory creates the instances of a fresh cluster with the given number of nodes.
+//
+// The instance at index i must run as the node with ID i, and all instances
+// must be connected to each other.
+type ClusterFactory func(nodeCount int) []ExternalAPI
+
+var (
+	// factories holds all registered cluster factories by name.
+	factories      = map[string]ClusterFactory{}
+	factoriesMutex = &sync.RWMutex{}
+)
+
+// Register makes a cluster factory available under the given name, so that
+// tools like the contester binary can test the algorithm by its name.
+//
+// It is meant to be called from the init function of the package that implements
+// the algorithm. It panics if the name is already taken or the factory is nil.
+func Register(name string, factory ClusterFactory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("simulation: Register factory is nil")
+	}
+	if _, exists := factories[name]; exists {
+		panic("simulation: Register called twice for " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Lookup provides the cluster factory that is registered under the given name.
+func Lookup(name string) (ClusterFactory, error) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	factory, exists := factories[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown algorithm %q, registered algorithms: %v", name, registeredNames())
+	}
+	return factory, nil
+}
+
+// Algorithms provides the sorted names of all registered algorithms.
+func Algorithms() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	return registeredNames()
+}
+
+// registeredNames provides the sorted names of all registered algorithms.
+// The caller must hold the factories mutex.
+func registeredNames() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+package simulation
+
+import (
+	"fmt"
+	"time"
+
+	"contester/pkg/elle"
+)
+
+// Report of a simulation session. It holds everything that is known about
+// the session, and it can be serialised to JSON to be archived or compared.
+type Report struct {
+	// Seed that drove the session. It replays the session along with the config.
+	Seed int64
+	// NodeCount is the number of nodes in the simulated system.
+	NodeCount int
+	// Config of the session, with the seed in use.
+	Config Config
+	// History of all calls made, and faults injected, during the session.
+	History *History
+	// Verdict on the session.
+	Verdict Verdict
+	// Timing of the session.
+	Timing Timing
+	// Messages that the nodes sent to each other during the session.
+	Messages Messages
+}
+
+// Verdict on a simulation session.
+type Verdict struct {
+	// Ok is true if consensus was maintained.
+	Ok bool
+	// Error is the reason why consensus was not maintained. It is empty if Ok is true.
+	Error string
+
+	// Checked is true if the history was checked for linearizability. It is false
+	// if the session could not complete, for example, if the final read of the
+	// register workload failed. The list-append workload checks its history even
+	// then, with the final read as a transaction of unknown outcome. It is also
+	// false if the checker ran out of budget, see Unknown.
+	Checked bool
+	// Unknown is true if the checker ran out of budget before it could decide
+	// whether the register history of a key is linearizable. The history is then
+	// neither known to be linearizable, nor known to be broken.
+	Unknown bool
+	// Linearizable is true if the checker found a legal sequential order of all
+	// operations. For the list-append workload, it is true if the checker found
+	// no anomaly.
+	Linearizable bool
+	// Linearization holds indexes of History.Operations in a legal sequential order.
+	//
+	// If the history is not linearizable, it is the longest legal sequential
+	// prefix that the checker could find, which points to where the history
+	// breaks. Operations that cannot matter to the checker, like failed reads,
+	// are never part of it.
+	Linearization []int
+	// Anomalies found by the checker of the list-append workload. The IDs of
+	// their transactions are indexes of History.Operations.
+	Anomalies []elle.Anomaly
+}
+
+// Messages counts the messages of a simulation session, the ones of the final reads
+// included. Requests and responses count as a message each. Only the messages that
+// go through Context.Deliver or Context.NetworkOpTo are counted, as a plain
+// Context.NetworkOp does not tell which nodes it connects.
+type Messages struct {
+	// Sent is the number of messages that the nodes sent.
+	Sent int64
+	// Delivered is the number of sent messages that arrived.
+	Delivered int64
+	// Dropped is the number of sent messages that were lost, by a network failure,
+	// a partition or a crashed node.
+	Dropped int64
+	// Duplicated is the number of extra copies of requests that the network delivered.
+	// They are not part of the sent messages.
+	Duplicated int64
+}
+
+// Add provides the sum of the message counts.
+func (m Messages) Add(other Messages) Messages {
+	return Messages{
+		Sent:       m.Sent + other.Sent,
+		Delivered:  m.Delivered + other.Delivered,
+		Dropped:    m.Dropped + other.Dropped,
+		Duplicated: m.Duplicated + other.Duplicated,
+	}
+}
+
+// String formats the message counts, like "120 messages sent, 110 delivered, 10 dropped, 4 duplicated".
+func (m Messages) String() string {
+	return fmt.Sprintf("%d messages sent, %d delivered, %d dropped, %d duplicated",
+		m.Sent, m.Delivered, m.Dropped, m.Duplicated)
+}
+
+// Timing of a simulation session.
+type Timing struct {
+	// Started is the wall clock time at which the session started.
+	Started time.Time
+	// WallTime is the real time that the session took.
+	WallTime time.Duration
+	// SimulatedTime is the simulated time that the session took.
+	SimulatedTime time.Duration
+}
@@ -0,0 +1,332 @@
+package simulation
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// stallTimeout is the real time for which the scheduler waits for a running
+// goroutine of the simulation to park, before it gives up on it. A goroutine that
+// takes that long blocks on something other than the scheduler.
+const stallTimeout = time.Second
+
+// ErrStalled is returned when the simulation cannot make progress anymore, as a
+// goroutine of the simulation blocks on something other than the scheduler, or no
+// goroutine can run and nothing is scheduled, but the session is not over.
+var ErrStalled = errors.New("simulation stalled: no goroutine can run and no events are pending, but the session is not over")
+
+// simulationEpoch is the virtual time at which every simulation starts.
+//
+// It is a constant, so that runs with the same seed produce the same times.
+var simulationEpoch = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// scheduler is a discrete-event scheduler that runs a simulation in virtual time.
+//
+// The goroutines of the simulation are tasks of the scheduler, and only one of them
+// runs at a time. A task runs until it parks, for example to let time pass or to wait
+// for other tasks, and then the scheduler hands control to the next runnable task,
+// in the order in which they became runnable. Once no task can run, the scheduler
+// jumps the virtual time straight to the next event. So, delays cost no real time,
+// and the order of the tasks depends neither on the OS nor on the Go scheduler, which
+// makes a run reproducible however many threads the process has.
+//
+// That only holds if the tasks block on nothing but the scheduler. A task that blocks
+// on something else for the stall timeout stalls the session.
+type scheduler struct {
+	// now is the virtual time, relative to the start of the simulation.
+	now time.Duration
+	// events that are yet to fire, ordered by their time.
+	events eventQueue
+	// sequence breaks ties between events that fire at the same time.
+	sequence uint64
+
+	// runnable holds the tasks that can run, in the order in which they became runnable.
+	runnable []*task
+	// current is the task that runs, nil while the scheduler itself runs.
+	current *task
+	// tasks is the number of tasks that have not returned yet.
+	tasks int
+	// yield is how the running task hands control back to the scheduler.
+	yield chan struct{}
+	// watchdog fires if the running task does not hand control back in time.
+	watchdog *time.Timer
+	// stalled is true once a task failed to hand control back. The scheduler
+	// does not run any task after that, as it cannot know which one runs.
+	stalled bool
+
+	mutex *sync.Mutex
+}
+
+// task is a goroutine of the simulation.
+type task struct {
+	// resume hands control to the task.
+	resume chan struct{}
+}
+
+// newScheduler creates a new scheduler at the start of virtual time.
+func newScheduler() *scheduler {
+	watchdog := time.NewTimer(stallTimeout)
+	watchdog.Stop()
+
+	return &scheduler{
+		yield:    make(chan struct{}, 1),
+		watchdog: watchdog,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// Now provides the current virtual time, relative to the start of the simulation.
+func (s *scheduler) Now() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.now
+}
+
+// schedule the given function to be called after the given virtual duration.
+//
+// The function is called by the scheduler itself, so it must not block. A
+// negative duration counts as none, as the virtual time never goes backwards.
+func (s *scheduler) schedule(after time.Duration, fire func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if after < 0 {
+		after = 0
+	}
+
+	s.sequence++
+	heap.Push(&s.events, &event{at: s.now + after, sequence: s.sequence, fire: fire})
+}
+
+// sleep parks the running task for the given virtual duration.
+//
+// It returns an error if the given context is done, without parking.
+func (s *scheduler) sleep(ctx context.Context, duration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// No need to park if no time has to pass.
+	if duration <= 0 {
+		return nil
+	}
+
+	t := s.running()
+	s.schedule(duration, func() { s.ready(t) })
+	s.park(t)
+
+	return ctx.Err()
+}
+
+// spawn creates a new runnable task that runs the given function.
+func (s *scheduler) spawn(fn func()) {
+	t := &task{resume: make(chan struct{}, 1)}
+
+	s.mutex.Lock()
+	s.tasks++
+	s.mutex.Unlock()
+	s.ready(t)
+
+	go func() {
+		<-t.resume
+		defer s.exit()
+		fn()
+	}()
+}
+
+// join calls the given function for every index from 0 to n-1, each call in its own
+// task, and parks the running task until all calls have returned.
+func (s *scheduler) join(n int, call func(i int)) {
+	if n <= 0 {
+		return
+	}
+
+	parent := s.running()
+	// The tasks run one at a time, so the count needs no synchronization.
+	remaining := n
+	for i := 0; i < n; i++ {
+		i := i
+		s.spawn(func() {
+			call(i)
+			if remaining--; remaining == 0 {
+				s.ready(parent)
+			}
+		})
+	}
+
+	s.park(parent)
+}
+
+// running provides the task that runs. It panics if the scheduler itself runs, as
+// only tasks can park.
+func (s *scheduler) running() *task {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current == nil {
+		panic("simulation: only goroutines of the simulation can wait, not the scheduler or other goroutines")
+	}
+	return s.current
+}
+
+// ready makes the given task runnable.
+func (s *scheduler) ready(t *task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.runnable = append(s.runnable, t)
+}
+
+// park hands control back to the scheduler, and waits until the given task, which
+// is the running one, gets control again. Whatever parks the task must make sure
+// that it becomes runnable again.
+func (s *scheduler) park(t *task) {
+	s.mutex.Lock()
+	s.current = nil
+	s.mutex.Unlock()
+
+	s.yield <- struct{}{}
+	<-t.resume
+}
+
+// exit hands control back to the scheduler for good, as the running task returned.
+func (s *scheduler) exit() {
+	s.mutex.Lock()
+	s.current = nil
+	s.tasks--
+	s.mutex.Unlock()
+
+	s.yield <- struct{}{}
+}
+
+// runUntil runs the tasks and fires the events in order until the given condition holds.
+//
+// The condition is only evaluated when no task can run.
+func (s *scheduler) runUntil(done func() bool) error {
+	for {
+		// Let the tasks run until all of them are parked.
+		if err := s.runTasks(); err != nil {
+			return err
+		}
+		if done() {
+			return nil
+		}
+
+		// Jump to the next event.
+		ev, ok := s.pop()
+		if !ok {
+			return ErrStalled
+		}
+
+		ev.fire()
+	}
+}
+
+// runTask runs the given function in a new task, and runs the tasks and fires the
+// events in order until the function returns.
+func (s *scheduler) runTask(fn func()) error {
+	finished := false
+	s.spawn(func() {
+		defer func() { finished = true }()
+		fn()
+	})
+
+	return s.runUntil(func() bool { return finished })
+}
+
+// drain runs the tasks that are left once the session is over, until all of them
+// have returned. The context of the session is done by then, so the tasks return
+// as soon as they wait on the simulated time.
+func (s *scheduler) drain() {
+	_ = s.runUntil(func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		return s.tasks == 0
+	})
+}
+
+// runTasks hands control to the runnable tasks, one after the other, until none is left.
+func (s *scheduler) runTasks() error {
+	if s.stalled {
+		return ErrStalled
+	}
+
+	for {
+		s.mutex.Lock()
+		if len(s.runnable) == 0 {
+			s.mutex.Unlock()
+			return nil
+		}
+		t := s.runnable[0]
+		s.runnable[0] = nil
+		s.runnable = s.runnable[1:]
+		s.current = t
+		s.mutex.Unlock()
+
+		t.resume <- struct{}{}
+
+		s.watchdog.Reset(stallTimeout)
+		select {
+		case <-s.yield:
+			// The timer may have fired meanwhile, which must not count for the next task.
+			if !s.watchdog.Stop() {
+				<-s.watchdog.C
+			}
+		case <-s.watchdog.C:
+			s.stalled = true
+			return ErrStalled
+		}
+	}
+}
+
+// pop removes the next event from the queue and advances the virtual time to it.
+func (s *scheduler) pop() (*event, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.events.Len() == 0 {
+		return nil, false
+	}
+
+	ev := heap.Pop(&s.events).(*event)
+	s.now = ev.at
+	return ev, true
+}
+
+// event is something that happens at a certain virtual time.
+type event struct {
+	// at is the virtual time of the event.
+	at time.Duration
+	// sequence orders the events that happen at the same time.
+	sequence uint64
+	// fire is called when the event happens.
+	fire func()
+}
+
+// eventQueue is a min-heap of events, implementing heap.Interface.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return last
+}
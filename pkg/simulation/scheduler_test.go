@@ -0,0 +1,93 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerNeverGoesBackInTime(t *testing.T) {
+	sched := newScheduler()
+
+	var fired []time.Duration
+	sched.schedule(10*time.Millisecond, func() {
+		fired = append(fired, sched.Now())
+		// An event in the past fires right away instead.
+		sched.schedule(-5*time.Millisecond, func() { fired = append(fired, sched.Now()) })
+	})
+
+	for {
+		ev, ok := sched.pop()
+		if !ok {
+			break
+		}
+		ev.fire()
+	}
+
+	want := []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}
+	if len(fired) != len(want) || fired[0] != want[0] || fired[1] != want[1] {
+		t.Errorf("events fired at %v, want %v", fired, want)
+	}
+}
+
+func TestSchedulerRunsTasksInOrder(t *testing.T) {
+	sched := newScheduler()
+	ctx := context.Background()
+
+	// Every task records its steps, and the tasks that sleep for the same time
+	// resume in the order in which they slept.
+	var steps []string
+	step := func(name string, n int) {
+		steps = append(steps, fmt.Sprintf("%s%d@%s", name, n, sched.Now()))
+	}
+	err := sched.runTask(func() {
+		sched.join(3, func(i int) {
+			name := string(rune('a' + i))
+			step(name, 1)
+			_ = sched.sleep(ctx, time.Duration(i%2+1)*time.Millisecond)
+			step(name, 2)
+		})
+		step("joined", 0)
+	})
+	if err != nil {
+		t.Fatalf("runTask() error = %v", err)
+	}
+
+	want := []string{"a1@0s", "b1@0s", "c1@0s", "a2@1ms", "c2@1ms", "b2@2ms", "joined0@2ms"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
+
+func TestSchedulerStalls(t *testing.T) {
+	sched := newScheduler()
+
+	// A task that parks with nothing to wake it up stalls the session right away.
+	err := sched.runTask(func() {
+		sched.park(sched.running())
+	})
+	if !errors.Is(err, ErrStalled) {
+		t.Errorf("runTask() error = %v, want %v", err, ErrStalled)
+	}
+}
+
+func TestSchedulerDrainsTasks(t *testing.T) {
+	sched := newScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// A task that still sleeps once the session is over returns when it is drained.
+	var slept error
+	sched.spawn(func() { slept = sched.sleep(ctx, time.Hour) })
+	if err := sched.runUntil(func() bool { return true }); err != nil {
+		t.Fatalf("runUntil() error = %v", err)
+	}
+
+	cancel()
+	sched.drain()
+	if !errors.Is(slept, context.Canceled) || sched.tasks != 0 {
+		t.Errorf("sleep() = %v with %d tasks left, want %v and none", slept, sched.tasks, context.Canceled)
+	}
+}
@@ -3,7 +3,12 @@ package simulation
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"contester/pkg/elle"
+	"contester/pkg/linearizability"
 )
 
 // ExternalAPI represents an API that a node in a distributed system
@@ -13,10 +18,18 @@ import (
 // in parallel across multiple nodes in the system.
 //
 // Importantly, implementations should-
-//  1. Use ctx.Time() method instead of time.Now() function to get the
-//     current time.
-//  2. Call ctx.NetworkOp() method before an IPC which would've been a
-//     network operation in an actual system.
+//  1. Use ctx.TimeOf() or ctx.Time() method instead of time.Now() function
+//     to get the current time.
+//  2. Send every IPC, which would've been a network operation in an actual
+//     system, through the ctx.Deliver() method. Alternatively, call the
+//     ctx.NetworkOp() method before such an IPC.
+//  3. Use ctx.Sleep() method instead of time.Sleep() function, as the
+//     simulation runs in simulated time.
+//  4. Use ctx.MonotonicOf() or ctx.Monotonic() method to measure durations
+//     on a node, as the clocks of ctx.TimeOf() may be offset and jump.
+//  5. Use ctx.Concurrently() method instead of the go statement, and never
+//     hold a lock while calling the methods above, as the simulation runs
+//     one goroutine at a time, and switches between them in those methods.
 //
 // The calls listed above make sure that the implementation respects the
 // simulation configs.
@@ -29,95 +42,457 @@ type ExternalAPI interface {
 	Set(ctx Context, state string) (err error)
 }
 
+// Restartable can be implemented by an ExternalAPI whose node keeps state in memory.
+//
+// If the simulation is configured to crash nodes with amnesia, it calls Restart
+// when a crashed node comes back up. The implementation should then drop all the
+// in-memory state of the node, as a real process would lose it in a crash. Restart
+// is called before the node is back up, and it must not block.
+type Restartable interface {
+	Restart()
+}
+
+// Closer can be implemented by an ExternalAPI whose node holds resources, like files.
+//
+// The simulation calls Close on every instance once the session is over, whether
+// consensus was maintained or not. The instances are not used after that.
+type Closer interface {
+	Close() error
+}
+
 // Run the simulation for the given configs and node instances.
+//
+// The simulation runs in virtual time, one goroutine at a time, so a seed replays
+// a session exactly. Sessions have no effect on the rest of the process, so many
+// of them may run concurrently.
+//
+// A session in which no goroutine can run and nothing is scheduled, or whose
+// running goroutine blocks on something other than the simulation for a second
+// of real time, is stalled.
 func Run(conf Config, instances []ExternalAPI) error {
+	_, err := RunWithReport(conf, instances)
+	return err
+}
+
+// RunWithHistory runs the simulation for the given configs and node instances,
+// and returns the history of all ExternalAPI calls made during the run.
+//
+// The history is returned even if consensus is broken, so that it can be analysed.
+// It is nil only if the simulation could not be run at all.
+func RunWithHistory(conf Config, instances []ExternalAPI) (*History, error) {
+	report, err := RunWithReport(conf, instances)
+	if report == nil {
+		return nil, err
+	}
+	return report.History, err
+}
+
+// RunWithReport runs the simulation for the given configs and node instances,
+// and returns a full report of the run.
+//
+// The report is returned even if consensus is broken, so that it can be analysed.
+// It is nil only if the simulation could not be run at all.
+func RunWithReport(conf Config, instances []ExternalAPI) (*Report, error) {
+	// The instances are closed last, once no goroutine of the session uses them anymore.
+	defer closeInstances(instances)
+
 	// Validate the user provided config.
 	if err := conf.validate(); err != nil {
-		return fmt.Errorf("invalid config provided: %w", err)
+		return nil, fmt.Errorf("invalid config provided: %w", err)
+	}
+	if err := validateInstances(conf, instances); err != nil {
+		return nil, fmt.Errorf("invalid instances provided: %w", err)
+	}
+
+	// Pick a seed if none was provided.
+	if conf.Seed == 0 {
+		conf.Seed = randomSeed()
 	}
 
+	// The context is cancelled once the session is over, which releases any
+	// goroutines that are still waiting in the simulated time.
+	baseCtx, cancel := context.WithCancel(context.Background())
+
 	// Create context for the simulation.
 	simulationCtx := kontext{
-		Context: context.Background(),
-		conf:    conf,
+		Context:  baseCtx,
+		conf:     conf,
+		random:   newRandom(conf.Seed),
+		sched:    newScheduler(),
+		net:      newNetwork(),
+		messages: &messageCounter{},
+	}
+
+	// Every node gets its own clock.
+	simulationCtx.clocks = newClockSet(conf, len(instances), simulationCtx.random.derive(clockRandomKey))
+
+	report := &Report{
+		Seed:      conf.Seed,
+		NodeCount: len(instances),
+		Config:    conf,
+		Timing:    Timing{Started: time.Now()},
 	}
 
 	// Run the simulation with all validated parameters.
-	if err := run(simulationCtx, instances); err != nil {
-		return err // No wrapping required.
+	err := run(simulationCtx, instances, report)
+
+	report.Timing.WallTime = time.Since(report.Timing.Started)
+	report.Timing.SimulatedTime = simulationCtx.sched.Now()
+	report.Messages = simulationCtx.messages.snapshot()
+
+	// Let the goroutines that are left return, like the ones of duplicate messages
+	// that are still in flight, so that none of them outlives the session.
+	cancel()
+	simulationCtx.sched.drain()
+
+	// A run without history could not run at all.
+	if report.History == nil {
+		return nil, err
+	}
+
+	if err != nil {
+		// The seed is all that is needed to replay the failed run.
+		err = fmt.Errorf("simulation with seed %d failed: %w", conf.Seed, err)
+		report.Verdict.Error = err.Error()
+		return report, err
 	}
 
 	// Consensus maintained.
-	return nil
+	report.Verdict.Ok = true
+	return report, nil
 }
 
-// run a simulation session.
-func run(ctx kontext, instances []ExternalAPI) error {
+// closeInstances closes the instances that implement the Closer interface. Their
+// errors concern their own resources, not consensus, so they are not reported.
+func closeInstances(instances []ExternalAPI) {
+	for _, instance := range instances {
+		if closer, ok := instance.(Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// run a simulation session, and fill the history and verdict of the given report.
+func run(ctx kontext, instances []ExternalAPI, report *Report) error {
+	// The recorder for all operations.
+	rec := newRecorder(ctx.sched.Now)
+
+	// All faults are injected through a single injector.
+	faults := newInjector(ctx, instances, rec)
+
+	// Inject partitions while the requests are running, if configured.
+	if len(ctx.conf.PartitionKinds) > 0 {
+		startPartitions(faults)
+	}
+
+	// Crash nodes while the requests are running, if configured.
+	if ctx.conf.CrashDuration > 0 {
+		startCrashes(faults)
+	}
+
+	// Step the clocks while the requests are running, if configured.
+	if ctx.conf.MaxClockJump > 0 {
+		startClockJumps(faults)
+	}
+
+	// Let the nemesis schedule its own faults, if configured.
+	if ctx.conf.Nemesis != nil {
+		if err := ctx.conf.Nemesis.Start(faults); err != nil {
+			// The report is left without history, as the run could not start.
+			return fmt.Errorf("failed to start nemesis: %w", err)
+		}
+	}
+
 	// Send the required number of requests.
-	states := sendRoundRobinRequests(ctx, instances)
+	if err := sendRoundRobinRequests(ctx, instances, rec); err != nil {
+		report.History = rec.snapshot()
+		return err
+	}
+
+	// The final read happens in a healthy network, with all nodes up.
+	faults.stop(ctx.conf.CrashAmnesia)
 
-	// Determine the expected state.
-	var expectedState string
-	if len(states) != 0 {
-		expectedState = states[len(states)-1]
+	if ctx.conf.Workload == WorkloadListAppend {
+		return checkLists(ctx, instances, rec, report)
 	}
+	return checkRegisters(ctx, instances, rec, report)
+}
+
+// checkRegisters reads the final state of every register, and checks the history
+// of every register for linearizability. It fills the history and verdict of
+// the given report.
+func checkRegisters(ctx kontext, instances []ExternalAPI, rec *recorder, report *Report) error {
+	// The final reads are made by dedicated clients, one per key, which come
+	// after all request clients.
+	finalClient := int(ctx.conf.RequestCount)
+	keys := workloadKeys(ctx.conf)
 
 	// Use ideal config for getting the current state.
 	ctx.conf = idealConfig
-	// Get the current/actual state.
-	actualState, err := instances[0].Get(ctx)
+	ctx.node = 0
+	// Get the current/actual state of every key. These reads happen after all
+	// the requests are done, so they must observe the effect of every successful write.
+	actualStates := make([]string, len(keys))
+	var err error
+	errRun := ctx.sched.runTask(func() {
+		for k, key := range keys {
+			id := rec.invoke(0, finalClient+k, key, OperationGet, "")
+			state, errGet := get(ctx, instances[0], key)
+			rec.complete(id, state, errGet)
+
+			if errGet != nil {
+				err = fmt.Errorf("failed to get state%s: %w", keySuffix(key), errGet)
+				return
+			}
+			actualStates[k] = state
+		}
+	})
+
+	report.History = rec.snapshot()
+	if errRun != nil {
+		return errRun
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get state: %w", err)
+		return err
 	}
 
-	// Verify the state.
-	if actualState != expectedState {
-		return fmt.Errorf("consensus broken. expected state: %s, but got: %s",
-			expectedState, actualState)
+	// Verify that a legal sequential order of all operations exists, for every
+	// key on its own.
+	report.Verdict.Checked = true
+	report.Verdict.Linearizable = true
+	var errBroken, errUnknown error
+	for k, key := range keys {
+		ops, indexes := report.History.registerOperations(key)
+		result := linearizability.Check(linearizability.CASRegisterModel, ops)
+
+		for _, i := range result.Order {
+			report.Verdict.Linearization = append(report.Verdict.Linearization, indexes[i])
+		}
+
+		switch {
+		case result.Unknown && errUnknown == nil:
+			report.Verdict.Unknown = true
+			errUnknown = fmt.Errorf("history%s could not be checked, as the checker ran out of budget", keySuffix(key))
+		case !result.Ok && !result.Unknown && errBroken == nil:
+			report.Verdict.Linearizable = false
+			errBroken = fmt.Errorf("consensus broken. history%s is not linearizable, final state: %s",
+				keySuffix(key), actualStates[k])
+		}
 	}
 
+	// A broken history is broken, whatever the other keys are.
+	if errBroken != nil {
+		return errBroken
+	}
+	if errUnknown != nil {
+		report.Verdict.Checked = false
+		report.Verdict.Linearizable = false
+		return errUnknown
+	}
 	return nil
 }
 
+// checkLists reads the final state of all lists, and checks the history of
+// transactions for anomalies. It fills the history and verdict of the given report.
+//
+// A failed final read does not skip the check, as the rest of the history may
+// still show anomalies. The read is then recorded with an unknown outcome, and
+// its failure is reported along with any anomalies.
+func checkLists(ctx kontext, instances []ExternalAPI, rec *recorder, report *Report) error {
+	// The final read is a single transaction of a dedicated client, which comes
+	// after all request clients. It reads all lists, so that the order of their
+	// values is known in full.
+	finalClient := int(ctx.conf.RequestCount)
+	var txn []ListOp
+	for _, key := range listKeys(ctx.conf) {
+		txn = append(txn, ListOp{Kind: ListRead, Key: key})
+	}
+
+	// Use ideal config for getting the current state.
+	ctx.conf = idealConfig
+	ctx.node = 0
+
+	var err error
+	errRun := ctx.sched.runTask(func() {
+		id := rec.invokeTransaction(0, finalClient, txn)
+		result, errTransact := transact(ctx, instances[0], txn)
+		rec.completeTransaction(id, result, errTransact)
+
+		if errTransact != nil {
+			err = fmt.Errorf("failed to read lists: %w", errTransact)
+		}
+	})
+
+	report.History = rec.snapshot()
+	if errRun != nil {
+		return errRun
+	}
+
+	// Search the transactions for anomalies. A failed final read is among them,
+	// with an unknown outcome.
+	result := elle.Check(report.History.listTransactions())
+	report.Verdict.Checked = true
+	report.Verdict.Linearizable = result.Ok
+	report.Verdict.Anomalies = result.Anomalies
+	if result.Ok {
+		return err
+	}
+
+	kinds := make([]string, 0, len(result.Anomalies))
+	for _, kind := range result.Kinds() {
+		kinds = append(kinds, string(kind))
+	}
+	errBroken := fmt.Errorf("consensus broken. history has anomalies %s, the first of which: %s",
+		strings.Join(kinds, ", "), result.Anomalies[0].Description)
+	if err != nil {
+		return fmt.Errorf("%w; %w", errBroken, err)
+	}
+	return errBroken
+}
+
+// keySuffix formats the given key for messages, like " of key key-1".
+// It is empty for the empty key.
+func keySuffix(key string) string {
+	if key == "" {
+		return ""
+	}
+	return " of key " + key
+}
+
 // sendRoundRobinRequests sends the configured number of requests in round-robin
-// fashion to the provided instances.
+// fashion to the provided instances. Every request is randomly chosen to be a
+// read or a write as per the configured read ratio, and, if there are many
+// keys, it goes to a random key. Writes are randomly chosen to be plain or
+// compare-and-set writes as per the configured CAS ratio. For the list-append
+// workload, every request is a random transaction instead.
 //
-// It ignores failures, and returns the list of successful resposes, in the SAME
-// order as they were received.
-func sendRoundRobinRequests(ctx kontext, instances []ExternalAPI) []string {
+// Every request is made by its own client, and it is recorded along with its
+// outcome using the given recorder. Failures are recorded too, as they may or
+// may not have taken effect.
+//
+// It returns once all requests are complete, or if the simulation stalls.
+func sendRoundRobinRequests(ctx kontext, instances []ExternalAPI, rec *recorder) error {
 	// Short hand for config.
 	conf := ctx.conf
 
-	// The channel that will receive all responses from the system.
-	responseChan := make(chan func() (string, error), conf.RequestCount)
-	defer close(responseChan)
+	// The number of completed requests.
+	var completed int64
 
 	// Get node count for easy usage below.
 	nodeCount := int64(len(instances))
+	// The keys that the requests are spread across.
+	keys := workloadKeys(conf)
+	// The values of all writes so far, in the order of the requests. A
+	// compare-and-set request expects one of the most recent ones.
+	var written []string
+	// The keys of the list-append workload, and the last value appended to each.
+	lists, counters := listKeys(conf), map[string]int{}
 
 	// Call the external API in round-robin requestCount-times.
 	for i := int64(0); i < conf.RequestCount; i++ {
-		go func(i int64) {
-			// Generate a random state for every request.
-			state := getRandomValue()
-			// External API call.
-			err := instances[i%nodeCount].Set(ctx, state)
-			responseChan <- func() (string, error) { return state, err }
-		}(i)
-
-		// Sleep for some time before sending another request.
-		// This avoids "true simultaneity".
-		time.Sleep(conf.RequestInterval)
-	}
+		// Every request gets its own random source, so that its decisions
+		// do not depend on how the concurrent requests get scheduled.
+		reqCtx := ctx
+		reqCtx.random = ctx.random.fork()
+		reqCtx.node = NodeID(i % nodeCount)
 
-	var success []string
-	// Collect all non-error responses.
-	for i := int64(0); i < conf.RequestCount; i++ {
-		state, err := (<-responseChan)()
-		if err == nil {
-			success = append(success, state)
+		// Transactions are all the list-append workload is about.
+		if conf.Workload == WorkloadListAppend {
+			txn := newTransaction(reqCtx.random, conf, lists, counters)
+
+			request := func(i int64, ctx kontext) {
+				defer atomic.AddInt64(&completed, 1)
+				node := int(i % nodeCount)
+
+				// External API call, unless the node is down.
+				id := rec.invokeTransaction(node, int(i), txn)
+				result, err := []ListOp(nil), errNodeDown
+				if ctx.net.isUp(NodeID(node)) {
+					result, err = transact(ctx, instances[node], txn)
+				}
+				rec.completeTransaction(id, result, err)
+			}
+
+			i := i
+			ctx.sched.schedule(time.Duration(i)*conf.RequestInterval, func() {
+				ctx.sched.spawn(func() { request(i, reqCtx) })
+			})
+			continue
+		}
+
+		// Decide the kind of the request beforehand.
+		isRead := reqCtx.random.biasedBoolean(conf.ReadRatio)
+		// And its key, if there are many.
+		key := keys[0]
+		if len(keys) > 1 {
+			key = keys[reqCtx.random.intn(len(keys))]
 		}
+
+		// Generate a random state for every write request.
+		var state string
+		if !isRead {
+			state = reqCtx.random.value()
+		}
+
+		// And decide whether a write is a compare-and-set, if configured.
+		isCAS := !isRead && conf.CASRatio > 0 && reqCtx.random.biasedBoolean(conf.CASRatio)
+		var expected string
+		if isCAS && len(written) > 0 {
+			recent := written
+			if len(recent) > casWindow {
+				recent = recent[len(recent)-casWindow:]
+			}
+			expected = recent[reqCtx.random.intn(len(recent))]
+		}
+		if !isRead {
+			written = append(written, state)
+		}
+
+		request := func(i int64, ctx kontext) {
+			defer atomic.AddInt64(&completed, 1)
+			node := int(i % nodeCount)
+
+			if isRead {
+				// External API call, unless the node is down.
+				id := rec.invoke(node, int(i), key, OperationGet, "")
+				state, err := "", errNodeDown
+				if ctx.net.isUp(NodeID(node)) {
+					state, err = get(ctx, instances[node], key)
+				}
+				rec.complete(id, state, err)
+				return
+			}
+
+			if isCAS {
+				// External API call, unless the node is down.
+				id := rec.invokeCompareAndSet(node, int(i), expected, state)
+				swapped, err := false, errNodeDown
+				if ctx.net.isUp(NodeID(node)) {
+					swapped, err = compareAndSet(ctx, instances[node], expected, state)
+				}
+				rec.completeCompareAndSet(id, swapped, err)
+				return
+			}
+
+			// External API call, unless the node is down.
+			id := rec.invoke(node, int(i), key, OperationSet, state)
+			err := errNodeDown
+			if ctx.net.isUp(NodeID(node)) {
+				err = set(ctx, instances[node], key, state)
+			}
+			rec.complete(id, "", err)
+		}
+
+		// Keep some simulated time between requests.
+		// This avoids "true simultaneity".
+		i := i
+		ctx.sched.schedule(time.Duration(i)*conf.RequestInterval, func() {
+			ctx.sched.spawn(func() { request(i, reqCtx) })
+		})
 	}
 
-	return success
+	// Let the simulated time run until all requests are complete.
+	return ctx.sched.runUntil(func() bool {
+		return atomic.LoadInt64(&completed) == conf.RequestCount
+	})
 }
@@ -0,0 +1,137 @@
+package simulation_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	// Algorithms register themselves with the simulation when imported.
+	_ "contester/pkg/kevlar"
+	"contester/pkg/naive"
+	_ "contester/pkg/paxos"
+	_ "contester/pkg/raft"
+
+	"contester/pkg/simulation"
+)
+
+func TestRunReplaysSeed(t *testing.T) {
+	conf := simulation.QuickStartConfig
+	conf.RequestCount = 30
+	conf.KeyCount = 3
+	conf.CrashAmnesia = true
+	conf.Seed = 100
+
+	for _, algorithm := range simulation.Algorithms() {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			// Sessions run in parallel must still replay the seed.
+			t.Parallel()
+			createInstances, _ := simulation.Lookup(algorithm)
+
+			histories := make([]*simulation.History, 2)
+			var wg sync.WaitGroup
+			for n := range histories {
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					histories[n], _ = simulation.RunWithHistory(conf, createInstances(5))
+				}(n)
+			}
+			wg.Wait()
+
+			if histories[0] == nil || histories[1] == nil {
+				t.Fatal("RunWithHistory() returned no history")
+			}
+			if !reflect.DeepEqual(histories[0], histories[1]) {
+				t.Errorf("histories of seed %d differ:\n%s\n\nand:\n%s", conf.Seed, histories[0], histories[1])
+			}
+		})
+	}
+}
+
+func TestRunChecksListsDespiteFailedFinalRead(t *testing.T) {
+	conf := simulation.QuickStartConfig
+	conf.Workload = simulation.WorkloadListAppend
+	conf.KeyCount = 2
+	conf.RequestCount = 20
+	conf.Seed = 47
+
+	report, err := simulation.RunWithReport(conf, naive.NewCluster(5))
+	if err == nil || !strings.Contains(err.Error(), "failed to read lists") {
+		t.Fatalf("RunWithReport() error = %v, want a failed final read", err)
+	}
+	if !report.Verdict.Checked || len(report.Verdict.Anomalies) == 0 {
+		t.Errorf("RunWithReport() verdict = %+v, want anomalies despite the failed final read", report.Verdict)
+	}
+	if !strings.Contains(err.Error(), "consensus broken") {
+		t.Errorf("RunWithReport() error = %v, want the anomalies reported too", err)
+	}
+}
+
+func TestRunCountsMessages(t *testing.T) {
+	conf := simulation.QuickStartConfig
+	conf.Seed = 42
+
+	report, err := simulation.RunWithReport(conf, naive.NewCluster(5))
+	if report == nil {
+		t.Fatalf("RunWithReport() error = %v", err)
+	}
+
+	messages := report.Messages
+	if messages.Sent == 0 || messages.Dropped == 0 {
+		t.Errorf("Messages = %+v, want some sent and some dropped, as the network fails", messages)
+	}
+	if messages.Sent != messages.Delivered+messages.Dropped {
+		t.Errorf("Messages = %+v, want every sent message delivered or dropped", messages)
+	}
+
+	// The same seed sends the same messages.
+	again, err := simulation.RunWithReport(conf, naive.NewCluster(5))
+	if again == nil {
+		t.Fatalf("RunWithReport() error = %v", err)
+	}
+	if again.Messages != messages {
+		t.Errorf("Messages of the replay = %+v, want %+v", again.Messages, messages)
+	}
+}
+
+// nemesisFunc implements the simulation.Nemesis interface with a function.
+type nemesisFunc func(faults simulation.Faults) error
+
+func (f nemesisFunc) Start(faults simulation.Faults) error {
+	return f(faults)
+}
+
+func TestFaultsIgnoreUnknownNodes(t *testing.T) {
+	conf := simulation.QuickStartConfig
+	conf.PartitionKinds = nil
+	conf.CrashDuration = 0
+	conf.MaxClockJump = 0
+	conf.Seed = 42
+	conf.Nemesis = nemesisFunc(func(faults simulation.Faults) error {
+		faults.At(0, func() {
+			faults.Crash(5)
+			faults.Restart(-1, true)
+			faults.JumpClock(7, time.Second)
+			faults.Partition([][]simulation.NodeID{{0, 1, 9}, {2, 3, 4}})
+		})
+		return nil
+	})
+
+	history, err := simulation.RunWithHistory(conf, naive.NewCluster(5))
+	if history == nil {
+		t.Fatalf("RunWithHistory() error = %v", err)
+	}
+
+	// Only the partition is left, without the unknown node.
+	var faults []string
+	for _, fault := range history.Faults {
+		faults = append(faults, fault.Description)
+	}
+	want := []string{"custom partition {0,1}|{2,3,4}", "network healed"}
+	if !reflect.DeepEqual(faults, want) {
+		t.Errorf("faults = %q, want %q", faults, want)
+	}
+}
@@ -2,16 +2,82 @@ package simulation
 
 import (
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/goombaio/namegenerator"
 )
 
-// _randomSource is the common source for random stuff generation.
-var _randomSource = rand.NewSource(time.Now().UnixNano())
+// Keys of the random sources that are derived for the fault injectors.
+const (
+	partitionRandomKey int64 = -1 - iota
+	crashRandomKey
+	clockRandomKey
+	clockJumpRandomKey
+	nemesisRandomKey
+)
+
+// random is the source of every random decision taken in a simulation.
+// It is safe for concurrent use.
+type random struct {
+	seed        int64
+	source      *rand.Rand
+	nameGen     namegenerator.Generator
+	sourceMutex *sync.Mutex
+
+	// derived holds the sources created by the derive method.
+	derived map[int64]*random
+}
+
+// newRandom creates a new random source with the given seed.
+func newRandom(seed int64) *random {
+	source := rand.New(rand.NewSource(seed))
+	return &random{
+		seed:   seed,
+		source: source,
+		// The name generator gets its own seed from the source, so its
+		// values do not simply mirror the other random decisions.
+		nameGen:     namegenerator.NewNameGenerator(source.Int63()),
+		sourceMutex: &sync.Mutex{},
+		derived:     map[int64]*random{},
+	}
+}
+
+// derive provides the random source for the given key. It is created on the
+// first call, and the same source is returned for the same key afterwards.
+//
+// Unlike fork, the seed of the derived source depends only on the key, and not
+// on the order of the calls. So, concurrent activities that are known by a key,
+// like messages over a network link, always get the same random decisions.
+func (r *random) derive(key int64) *random {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	if derived, exists := r.derived[key]; exists {
+		return derived
+	}
+
+	derived := newRandom(mixSeed(r.seed, key))
+	r.derived[key] = derived
+	return derived
+}
+
+// fork creates a new random source that is seeded by this one.
+//
+// It allows concurrent activities, like requests, to have their own sequence
+// of random decisions, which does not depend on the order in which the
+// activities happen to run.
+func (r *random) fork() *random {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	return newRandom(r.source.Int63())
+}
 
 // biasedBoolean returns a boolean randomly that is as likely to be true as specified.
-func biasedBoolean(probabilityOfTrue float64) bool {
+func (r *random) biasedBoolean(probabilityOfTrue float64) bool {
 	if probabilityOfTrue > 1 || probabilityOfTrue < 0 {
 		panic("probability should be between 0 and 1 both inclusive")
 	}
@@ -22,26 +88,104 @@ func biasedBoolean(probabilityOfTrue float64) bool {
 	case 0:
 		return false
 	default:
-		return probabilityOfTrue > rand.New(_randomSource).Float64()
+		r.sourceMutex.Lock()
+		defer r.sourceMutex.Unlock()
+		return probabilityOfTrue > r.source.Float64()
 	}
 }
 
-// randomDurationBetween returns a random time duration in the given range, both inclusive.
-func randomDurationBetween(min, max time.Duration) time.Duration {
+// durationBetween returns a random time duration in the given range, both inclusive.
+func (r *random) durationBetween(min, max time.Duration) time.Duration {
 	// Special case for good performance.
 	if max == 0 {
 		return 0
 	}
 
-	minInt, maxInt := int(min), int(max)
-	randomBW := rand.Intn(maxInt-minInt+1) + minInt
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	minInt, maxInt := int64(min), int64(max)
+	randomBW := r.source.Int63n(maxInt-minInt+1) + minInt
 	return time.Duration(randomBW)
 }
 
-// _nameGen generates random readable values.
-var _nameGen = namegenerator.NewNameGenerator(time.Now().UTC().UnixNano())
+// float64Between returns a random number in the interval [min, max).
+func (r *random) float64Between(min, max float64) float64 {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	return min + r.source.Float64()*(max-min)
+}
+
+// permutation provides the IDs of the given number of nodes in a random order.
+func (r *random) permutation(nodeCount int) []NodeID {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	nodes := make([]NodeID, nodeCount)
+	for i, node := range r.source.Perm(nodeCount) {
+		nodes[i] = NodeID(node)
+	}
+	return nodes
+}
+
+// intn provides a random integer in the interval [0, n).
+func (r *random) intn(n int) int {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	return r.source.Intn(n)
+}
+
+// pick provides a random element of the given non-empty slice.
+func pick[T any](r *random, elems []T) T {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	return elems[r.source.Intn(len(elems))]
+}
+
+// value generates a random readable string.
+func (r *random) value() string {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	return r.nameGen.Generate()
+}
+
+// id generates a random UUID.
+func (r *random) id() string {
+	r.sourceMutex.Lock()
+	defer r.sourceMutex.Unlock()
+
+	// Reading from a math/rand source never fails.
+	id, _ := uuid.NewRandomFromReader(r.source)
+	return id.String()
+}
+
+// mixSeed combines a seed with a key into a new, well distributed seed.
+// It uses the finalizer of the SplitMix64 generator.
+func mixSeed(seed, key int64) int64 {
+	x := uint64(seed) ^ (uint64(key) * 0x9e3779b97f4a7c15)
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return int64(x ^ (x >> 31))
+}
+
+// randomSeed provides a seed for simulations that were not given one.
+func randomSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// eventCounter hands out strictly increasing positions on a timeline.
+//
+// If an event happens before another in real time, it is guaranteed to get
+// a smaller position, which is what the linearizability checker relies upon.
+type eventCounter struct {
+	count int64
+}
 
-// getRandomValue generates a random string.
-func getRandomValue() string {
-	return _nameGen.Generate()
+// next provides the position for an event that is happening now.
+func (e *eventCounter) next() int64 {
+	return atomic.AddInt64(&e.count, 1)
 }
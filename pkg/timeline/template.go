@@ -0,0 +1,111 @@
+package timeline
+
+import (
+	"html/template"
+)
+
+// pageTemplate renders a page. The page embeds its styles, and draws the chart
+// as inline SVG, so that it needs nothing but a browser.
+var pageTemplate = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: sans-serif; margin: 20px; color: #222; }
+  h1 { font-size: 20px; margin: 0 0 8px; }
+  .verdict { padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+  .verdict.ok { background: #e3f5e1; }
+  .verdict.broken { background: #fbe3e3; }
+  .legend span { display: inline-block; margin-right: 16px; font-size: 13px; }
+  .legend i { display: inline-block; width: 14px; height: 10px; margin-right: 4px; vertical-align: middle; }
+  .chart { overflow-x: auto; margin: 12px 0; }
+  svg text { font-size: 10px; }
+  .lane { fill: #fafafa; stroke: #ddd; }
+  .lane-label { font-size: 12px; }
+  .tick line { stroke: #eee; }
+  .op { stroke: #555; stroke-width: 0.5; }
+  .op-set, i.op-set { fill: #8ab6f9; background: #8ab6f9; }
+  .op-get, i.op-get { fill: #9fdc9c; background: #9fdc9c; }
+  .op-cas, i.op-cas { fill: #c6a4f2; background: #c6a4f2; }
+  .op-txn, i.op-txn { fill: #f2d07a; background: #f2d07a; }
+  .op-failed, i.op-failed { fill: #cfcfcf; background: #cfcfcf; }
+  .op-network, i.op-network { fill: #f6c177; background: #f6c177; }
+  .op-unlinearized { stroke: #d11; stroke-width: 2; }
+  .op-failure { stroke: #d11; stroke-width: 3; }
+  .partition { fill: #b58de8; fill-opacity: 0.12; }
+  .partition-label { fill: #6b3fb0; }
+  i.partition { background: #e7dcf7; }
+  .crash, i.crash { fill: #555; fill-opacity: 0.18; background: #d5d5d5; }
+  .latency, i.latency { fill: #e8a33d; background: #e8a33d; }
+  .clock-jump line { stroke: #1b7f79; stroke-dasharray: 3 2; }
+  .failure line { stroke: #d11; stroke-width: 2; }
+  .failure text { fill: #d11; font-size: 12px; }
+  ul.faults { font-size: 13px; columns: 2; }
+  ul.anomalies { font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="verdict {{if .Ok}}ok{{else}}broken{{end}}">{{.Verdict}}</div>
+<div class="legend">
+  <span><i class="op-set"></i>set</span>
+  <span><i class="op-get"></i>get</span>
+  <span><i class="op-cas"></i>compare-and-set</span>
+  <span><i class="op-txn"></i>transaction</span>
+  <span><i class="op-failed"></i>failed call</span>
+  <span><i class="op-network"></i>failed by the network</span>
+  <span><i class="partition"></i>partition</span>
+  <span><i class="crash"></i>node down</span>
+  <span><i class="latency"></i>latency spike</span>
+  <span>#n position in the linearization</span>
+  <span>red outline: not linearizable, or part of an anomaly</span>
+</div>
+<div class="chart">
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+  {{range .Lanes}}
+  <rect class="lane" x="0" y="{{.Y}}" width="{{$.Width}}" height="{{.Height}}"></rect>
+  <text class="lane-label" x="8" y="{{.Y}}" dy="16">{{.Label}}</text>
+  {{end}}
+  {{range .Ticks}}
+  <g class="tick">
+    <line x1="{{.X}}" y1="{{.Y1}}" x2="{{.X}}" y2="{{.Y2}}"></line>
+    <text x="{{.X}}" y="{{.Y2}}" dy="14" text-anchor="middle">{{.Text}}</text>
+  </g>
+  {{end}}
+  {{range .Regions}}
+  <g>
+    <title>{{.Title}}</title>
+    <rect class="{{.Class}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"></rect>
+    {{if .Text}}<text class="partition-label" x="{{.X}}" y="{{.Y}}" dx="2" dy="-4">{{.Text}}</text>{{end}}
+  </g>
+  {{end}}
+  {{range .Bars}}
+  <g>
+    <title>{{.Title}}</title>
+    <rect class="{{.Class}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}" rx="2"></rect>
+    {{if .Text}}<text x="{{.X}}" y="{{.Y}}" dx="3" dy="12">{{.Text}}</text>{{end}}
+  </g>
+  {{end}}
+  {{range .Markers}}
+  <g class="{{.Class}}">
+    <title>{{.Title}}</title>
+    <line x1="{{.X}}" y1="{{.Y1}}" x2="{{.X}}" y2="{{.Y2}}"></line>
+    {{if .Text}}<text x="{{.X}}" y="{{.Y1}}" dx="-3" dy="10" text-anchor="end">{{.Text}}</text>{{end}}
+  </g>
+  {{end}}
+</svg>
+</div>
+{{if .Anomalies}}
+<h2>Anomalies</h2>
+<ul class="anomalies">{{range .Anomalies}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+<h2>Faults</h2>
+{{if .Faults}}
+<ul class="faults">{{range .Faults}}<li>{{.}}</li>{{end}}</ul>
+{{else}}
+<p>No faults were injected.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,389 @@
+// Package timeline renders the report of a simulation session as a
+// self-contained HTML page.
+//
+// The page shows a lane for every node, with every call as a bar from its
+// invocation to its completion. Partitions, crashes, clock jumps and latency
+// spikes are drawn along with the calls, and so is the verdict of the checker:
+// the position of every call in the linearization, or, for a broken history,
+// the calls that could not be linearized and the point where the search failed.
+// For the list-append workload, the transactions of every anomaly are marked,
+// and the anomalies are listed below the chart.
+package timeline
+
+import (
+	"contester/pkg/simulation"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layout of the page, in pixels.
+const (
+	marginLeft   = 90
+	marginRight  = 30
+	marginTop    = 40
+	plotWidth    = 1400
+	rowHeight    = 22
+	barHeight    = 16
+	lanePadding  = 8
+	tickCount    = 10
+	minBarWidth  = 2
+	minTextWidth = 70
+)
+
+// page is the data that the template renders.
+type page struct {
+	Title   string
+	Verdict string
+	Ok      bool
+	Width   int
+	Height  int
+	Lanes   []lane
+	Regions []shape
+	Bars    []shape
+	Markers []marker
+	Ticks   []marker
+	Faults  []string
+	// Anomalies found in a list-append history.
+	Anomalies []string
+}
+
+// lane is the horizontal band of a node.
+type lane struct {
+	Label     string
+	Y, Height float64
+}
+
+// shape is a rectangle with an optional text and a tooltip.
+type shape struct {
+	X, Y, Width, Height float64
+	Class               string
+	Text                string
+	Title               string
+}
+
+// marker is a vertical line with an optional text and a tooltip.
+type marker struct {
+	X, Y1, Y2 float64
+	Class     string
+	Text      string
+	Title     string
+}
+
+// Render writes the HTML page of the given report to the given writer.
+func Render(w io.Writer, report *simulation.Report) error {
+	if report == nil || report.History == nil {
+		return fmt.Errorf("report has no history to render")
+	}
+
+	return pageTemplate.Execute(w, newPage(report))
+}
+
+// newPage lays out the page of the given report.
+func newPage(report *simulation.Report) *page {
+	history := report.History
+
+	p := &page{
+		Title:   fmt.Sprintf("Simulation with seed %d", report.Seed),
+		Verdict: verdictText(report.Verdict),
+		Ok:      report.Verdict.Ok,
+	}
+
+	// The time span of the chart covers every call and fault.
+	span := report.Timing.SimulatedTime
+	for _, op := range history.Operations {
+		span = maxDuration(span, op.Completed)
+	}
+	for _, fault := range history.Faults {
+		span = maxDuration(span, fault.Time)
+	}
+	span = maxDuration(span, time.Nanosecond)
+
+	x := func(t time.Duration) float64 {
+		return marginLeft + float64(t)/float64(span)*plotWidth
+	}
+
+	// Every node gets a lane, with enough rows for its concurrent calls.
+	rows := assignRows(history.Operations)
+	rowCounts := make([]int, report.NodeCount)
+	for i, op := range history.Operations {
+		// Calls of unknown nodes are left out.
+		if op.Node >= 0 && op.Node < report.NodeCount {
+			rowCounts[op.Node] = maxInt(rowCounts[op.Node], rows[i]+1)
+		}
+	}
+
+	laneY := make([]float64, report.NodeCount)
+	y := float64(marginTop)
+	for node := range rowCounts {
+		height := float64(maxInt(rowCounts[node], 1)*rowHeight + 2*lanePadding)
+		laneY[node] = y
+		p.Lanes = append(p.Lanes, lane{Label: fmt.Sprintf("node %d", node), Y: y, Height: height})
+		y += height
+	}
+	bottom := y
+
+	p.Width = marginLeft + plotWidth + marginRight
+	p.Height = int(bottom) + 30
+
+	// Time ticks along the bottom.
+	for i := 0; i <= tickCount; i++ {
+		t := span * time.Duration(i) / tickCount
+		p.Ticks = append(p.Ticks, marker{
+			X: x(t), Y1: marginTop, Y2: bottom, Class: "tick",
+			Text: formatDuration(t),
+		})
+	}
+
+	for _, anomaly := range report.Verdict.Anomalies {
+		p.Anomalies = append(p.Anomalies, fmt.Sprintf("%s: %s", anomaly.Kind, anomaly.Description))
+	}
+
+	p.addFaults(history.Faults, x, laneY, bottom, span)
+	p.addOperations(report, rows, x, laneY, bottom)
+
+	return p
+}
+
+// addFaults draws the given faults.
+func (p *page) addFaults(faults []simulation.Fault, x func(time.Duration) float64, laneY []float64, bottom float64, span time.Duration) {
+	// Start of the current partition and latency spike, and of every crash.
+	var partition, latency *simulation.Fault
+	crashes := map[simulation.NodeID]*simulation.Fault{}
+
+	laneHeight := func(node simulation.NodeID) float64 {
+		if int(node)+1 < len(laneY) {
+			return laneY[node+1] - laneY[node]
+		}
+		return bottom - laneY[node]
+	}
+	known := func(node simulation.NodeID) bool {
+		return node >= 0 && int(node) < len(laneY)
+	}
+
+	// endPartition draws the current partition, if any, up to the given time.
+	endPartition := func(end time.Duration) {
+		if partition != nil {
+			p.Regions = append(p.Regions, shape{
+				X: x(partition.Time), Y: marginTop, Width: x(end) - x(partition.Time), Height: bottom - marginTop,
+				Class: "partition", Text: partition.Partition.String(), Title: partition.Description,
+			})
+			partition = nil
+		}
+	}
+	endLatency := func(end time.Duration) {
+		if latency != nil {
+			p.Regions = append(p.Regions, shape{
+				X: x(latency.Time), Y: marginTop - 14, Width: x(end) - x(latency.Time), Height: 10,
+				Class: "latency", Title: latency.Description,
+			})
+			latency = nil
+		}
+	}
+	endCrash := func(node simulation.NodeID, end time.Duration, description string) {
+		if crash := crashes[node]; crash != nil && known(node) {
+			p.Regions = append(p.Regions, shape{
+				X: x(crash.Time), Y: laneY[node], Width: x(end) - x(crash.Time), Height: laneHeight(node),
+				Class: "crash", Title: crash.Description + ", " + description,
+			})
+		}
+		delete(crashes, node)
+	}
+
+	for i := range faults {
+		fault := &faults[i]
+		p.Faults = append(p.Faults, fmt.Sprintf("%s: %s", formatDuration(fault.Time), fault.Description))
+
+		switch fault.Kind {
+		case simulation.FaultPartition:
+			endPartition(fault.Time)
+			partition = fault
+		case simulation.FaultHeal:
+			endPartition(fault.Time)
+		case simulation.FaultCrash:
+			crashes[fault.Nodes[0]] = fault
+		case simulation.FaultRestart:
+			endCrash(fault.Nodes[0], fault.Time, fault.Description)
+		case simulation.FaultLatency:
+			endLatency(fault.Time)
+			latency = fault
+		case simulation.FaultLatencyReset:
+			endLatency(fault.Time)
+		case simulation.FaultClockJump:
+			if node := fault.Nodes[0]; known(node) {
+				p.Markers = append(p.Markers, marker{
+					X: x(fault.Time), Y1: laneY[node], Y2: laneY[node] + laneHeight(node),
+					Class: "clock-jump", Text: "⏱", Title: fault.Description,
+				})
+			}
+		}
+	}
+
+	// Faults that never ended last until the end of the chart.
+	endPartition(span)
+	endLatency(span)
+	for node := range crashes {
+		endCrash(node, span, "never restarted")
+	}
+}
+
+// addOperations draws a bar for every call, along with the verdict of the checker.
+func (p *page) addOperations(report *simulation.Report, rows []int, x func(time.Duration) float64, laneY []float64, bottom float64) {
+	history, verdict := report.History, report.Verdict
+
+	// Position of every call in the linearization.
+	positions := map[int]int{}
+	for position, index := range verdict.Linearization {
+		positions[index] = position + 1
+	}
+
+	// The calls that take part in an anomaly, for the list-append workload.
+	anomalous := map[int]bool{}
+	for _, anomaly := range verdict.Anomalies {
+		for _, index := range anomaly.Transactions {
+			anomalous[index] = true
+		}
+	}
+
+	// For a broken history, the failure point is the first completion of a
+	// call that the checker could not linearize. Anomalies have no such point.
+	failure := -1
+	if verdict.Checked && !verdict.Linearizable && len(verdict.Anomalies) == 0 {
+		for i, op := range history.Operations {
+			if _, linearized := positions[i]; linearized || op.Failed() {
+				continue
+			}
+			if failure < 0 || op.CompleteIndex < history.Operations[failure].CompleteIndex {
+				failure = i
+			}
+		}
+	}
+
+	for i, op := range history.Operations {
+		if op.Node < 0 || op.Node >= len(laneY) {
+			continue
+		}
+
+		classes := []string{"op", "op-" + string(op.Kind)}
+		switch {
+		case strings.Contains(op.Error, "network"):
+			classes = append(classes, "op-network")
+		case op.Failed():
+			classes = append(classes, "op-failed")
+		}
+
+		text := op.String()
+		// Drop the node, as the lane tells it already.
+		if _, call, found := strings.Cut(text, ": "); found {
+			text = call
+		}
+
+		position, linearized := positions[i]
+		switch {
+		case linearized:
+			text = fmt.Sprintf("#%d %s", position, text)
+		case len(verdict.Anomalies) > 0:
+			if anomalous[i] {
+				classes = append(classes, "op-unlinearized")
+			}
+		case verdict.Checked && !verdict.Linearizable && !op.Failed():
+			classes = append(classes, "op-unlinearized")
+		}
+		if i == failure {
+			classes = append(classes, "op-failure")
+		}
+
+		bar := shape{
+			X:      x(op.Invoked),
+			Y:      laneY[op.Node] + lanePadding + float64(rows[i]*rowHeight),
+			Width:  x(op.Completed) - x(op.Invoked),
+			Height: barHeight,
+			Class:  strings.Join(classes, " "),
+			Title: fmt.Sprintf("%s\n%s - %s", strings.ReplaceAll(op.String(), "; ", "\n"),
+				formatDuration(op.Invoked), formatDuration(op.Completed)),
+		}
+		if bar.Width < minBarWidth {
+			bar.Width = minBarWidth
+		}
+		if bar.Width >= minTextWidth {
+			bar.Text = text
+		}
+		p.Bars = append(p.Bars, bar)
+	}
+
+	if failure >= 0 {
+		op := history.Operations[failure]
+		p.Markers = append(p.Markers, marker{
+			X: x(op.Completed), Y1: marginTop - 20, Y2: bottom, Class: "failure",
+			Text:  "no linearization",
+			Title: fmt.Sprintf("no linearization includes: %s", op),
+		})
+	}
+}
+
+// assignRows places the calls of every node in rows, such that the calls in
+// a row never overlap. It returns the row of every call.
+func assignRows(ops []simulation.Operation) []int {
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return ops[order[a]].InvokeIndex < ops[order[b]].InvokeIndex })
+
+	rows := make([]int, len(ops))
+	// The completion index of the last call in every row, per node.
+	ends := map[int][]int64{}
+	for _, i := range order {
+		op := ops[i]
+		row := 0
+		for row < len(ends[op.Node]) && ends[op.Node][row] > op.InvokeIndex {
+			row++
+		}
+
+		if row == len(ends[op.Node]) {
+			ends[op.Node] = append(ends[op.Node], 0)
+		}
+		ends[op.Node][row] = op.CompleteIndex
+		rows[i] = row
+	}
+
+	return rows
+}
+
+// verdictText summarises the given verdict.
+func verdictText(verdict simulation.Verdict) string {
+	switch {
+	case verdict.Ok:
+		return "Consensus maintained. The history is linearizable."
+	case verdict.Checked && !verdict.Linearizable:
+		return "Consensus broken. The history is not linearizable. " + verdict.Error
+	case verdict.Unknown:
+		return "Consensus unknown. " + verdict.Error
+	default:
+		return "Consensus broken. " + verdict.Error
+	}
+}
+
+// formatDuration formats a duration with a precision that suits a chart.
+func formatDuration(d time.Duration) string {
+	if d >= time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.String()
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}